@@ -0,0 +1,142 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "sync"
+    "text/tabwriter"
+    "time"
+
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/tools/clientcmd"
+)
+
+// clusterTimeout bounds every request to a cluster, so that an unreachable
+// cluster fails instead of holding up the report.
+const clusterTimeout = 30 * time.Second
+
+// ClusterReport is the node report of a single kubeconfig context. Error is
+// set, and Nodes empty, if the cluster could not be queried. UsageError is
+// set if --usage was given but the metrics API could not be read; the report
+// is then without usage. Unpriced lists the nodes --pricing has no price
+// for, to warn about once every cluster has answered.
+type ClusterReport struct {
+    Context    string           `json:"context" yaml:"context"`
+    Error      string           `json:"error,omitempty" yaml:"error,omitempty"`
+    UsageError string           `json:"usage_error,omitempty" yaml:"usage_error,omitempty"`
+    Nodes      []NodeAllocation `json:"nodes,omitempty" yaml:"nodes,omitempty"`
+    Total      NodeAllocation   `json:"total" yaml:"total"`
+    Unpriced   []string         `json:"-" yaml:"-"`
+}
+
+// parseContexts returns the contexts named in the comma separated --contexts
+// value, or every context in the kubeconfig file with --all-contexts.
+func parseContexts(value string, all bool, path string) ([]string, error) {
+    if !all {
+        return parseGroupBy(value), nil
+    }
+    config, err := clientcmd.LoadFromFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var names []string
+    for name := range config.Contexts {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names, nil
+}
+
+// queryClusters builds the node report of every context concurrently.
+// Reports are in the order of contexts.
+func queryClusters(path string, contexts []string, selector string, showUsage bool, opts reportOptions) []ClusterReport {
+    reports := make([]ClusterReport, len(contexts))
+    var wg sync.WaitGroup
+    for i, contextName := range contexts {
+        wg.Add(1)
+        go func(i int, contextName string) {
+            defer wg.Done()
+            reports[i] = queryCluster(path, contextName, selector, showUsage, opts)
+        }(i, contextName)
+    }
+    wg.Wait()
+    return reports
+}
+
+func queryCluster(path, contextName, selector string, showUsage bool, opts reportOptions) ClusterReport {
+    report := ClusterReport{Context: contextName, Total: NodeAllocation{NodeName: "TOTAL"}}
+    fail := func(err error) ClusterReport {
+        report.Error = err.Error()
+        return report
+    }
+
+    config, err := contextConfig(path, contextName)
+    if err != nil {
+        return fail(err)
+    }
+    config.Timeout = clusterTimeout
+    clientset, err := kubernetes.NewForConfig(config)
+    if err != nil {
+        return fail(err)
+    }
+    source := newLiveSource(config, clientset)
+
+    nodes, err := source.Nodes(selector)
+    if err != nil {
+        return fail(err)
+    }
+    pods, err := source.Pods()
+    if err != nil {
+        return fail(err)
+    }
+    if opts.Pricing != nil {
+        report.Unpriced = opts.Pricing.unpriced(nodes)
+    }
+    var usage map[string]nodeUsage
+    if showUsage {
+        // Usage is best effort, as in the single cluster report
+        usage, err = source.Usage(pods)
+        if err != nil {
+            report.UsageError = err.Error()
+        }
+    }
+
+    allocations := buildAllocations(nodes, podsByNode(pods), usage, opts)
+    report.Total = filterAllocation(sumAllocations("TOTAL", allocations, opts.Basis), opts.CPUOnly, opts.RAMOnly, opts.PodsOnly)
+    report.Nodes = finishAllocations(allocations, opts)
+    return report
+}
+
+// writeClusterTable writes the node table with a leading CLUSTER column and
+// a total row after the nodes of each cluster. Clusters that could not be
+// queried get a single row with the error instead.
+func writeClusterTable(out io.Writer, reports []ClusterReport, noHeaders bool, columns []tableColumn) {
+    w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+    if !noHeaders {
+        fmt.Fprint(w, "CLUSTER\tNODE_NAME")
+        for _, column := range columns {
+            fmt.Fprintf(w, "\t%s", column.Header)
+        }
+        fmt.Fprintln(w)
+    }
+    printRow := func(contextName string, alloc NodeAllocation) {
+        values := []string{contextName, alloc.NodeName}
+        for _, column := range columns {
+            values = append(values, column.Value(alloc))
+        }
+        fmt.Fprintln(w, strings.Join(values, "\t"))
+    }
+    for _, report := range reports {
+        if report.Error != "" {
+            fmt.Fprintf(w, "%s\t<error: %s>\n", report.Context, report.Error)
+            continue
+        }
+        for _, alloc := range report.Nodes {
+            printRow(report.Context, alloc)
+        }
+        printRow(report.Context, report.Total)
+    }
+    w.Flush()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+    "fmt"
+
+    corev1 "k8s.io/api/core/v1"
+)
+
+// tableColumn describes one column of the table output. Key is the name the
+// column is referred to by in --sort-by and the threshold flags, and Number
+// is its value for sorting and filtering.
+type tableColumn struct {
+    Key    string
+    Header string
+    Value  func(alloc NodeAllocation) string
+    Number func(alloc NodeAllocation) float64
+}
+
+func intColumn(key, header string, value func(alloc NodeAllocation) int64) tableColumn {
+    return tableColumn{
+        Key:    key,
+        Header: header,
+        Value: func(alloc NodeAllocation) string {
+            return fmt.Sprintf("%d", value(alloc))
+        },
+        Number: func(alloc NodeAllocation) float64 {
+            return float64(value(alloc))
+        },
+    }
+}
+
+func floatColumn(key, header string, value func(alloc NodeAllocation) float64) tableColumn {
+    return tableColumn{
+        Key:    key,
+        Header: header,
+        Value: func(alloc NodeAllocation) string {
+            return fmt.Sprintf("%.2f", value(alloc))
+        },
+        Number: value,
+    }
+}
+
+// textColumn is a column without a numeric value; it sorts by its text.
+func textColumn(key, header string, value func(alloc NodeAllocation) string) tableColumn {
+    return tableColumn{Key: key, Header: header, Value: value}
+}
+
+var podColumns = []tableColumn{
+    intColumn("pod-capacity", "POD CAPACITY", func(a NodeAllocation) int64 { return a.PodCapacity }),
+    intColumn("pod-allocatable", "POD ALLOCATABLE", func(a NodeAllocation) int64 { return a.PodAllocatable }),
+    intColumn("deployed-pods", "DEPLOYED POD COUNT", func(a NodeAllocation) int64 { return a.DeployedPodCount }),
+    intColumn("terminated-pods", "TERMINATED POD COUNT", func(a NodeAllocation) int64 { return a.TerminatedPodCount }),
+    intColumn("available-pod-slots", "AVAILABLE POD SLOTS", func(a NodeAllocation) int64 { return a.AvailablePodSlots }),
+    intColumn("pods-without-limits", "PODS WITHOUT LIMITS", func(a NodeAllocation) int64 { return a.PodsWithoutLimits }),
+}
+
+var cpuColumns = []tableColumn{
+    floatColumn("cpu-capacity", "CPU CAPACITY (Cores)", func(a NodeAllocation) float64 { return a.CPUCapacity }),
+    floatColumn("cpu-allocatable", "CPU ALLOCATABLE (Cores)", func(a NodeAllocation) float64 { return a.CPUAllocatable }),
+    floatColumn("cpu-reserved", "CPU RESERVED (Cores)", func(a NodeAllocation) float64 { return a.CPUReserved }),
+    floatColumn("cpu-allocated", "CPU ALLOCATED (Cores)", func(a NodeAllocation) float64 { return a.CPUAllocated }),
+    floatColumn("cpu-allocated-pct", "CPU ALLOCATED (%)", func(a NodeAllocation) float64 { return a.CPUAllocatedPct }),
+    floatColumn("cpu-available", "CPU AVAILABLE (Cores)", func(a NodeAllocation) float64 { return a.CPUAvailable }),
+    floatColumn("cpu-limits", "CPU LIMITS (Cores)", func(a NodeAllocation) float64 { return a.CPULimits }),
+    floatColumn("cpu-overcommit", "CPU OVERCOMMIT", func(a NodeAllocation) float64 { return a.CPUOvercommit }),
+}
+
+var ramColumns = []tableColumn{
+    floatColumn("ram-capacity", "RAM CAPACITY (GB)", func(a NodeAllocation) float64 { return a.RAMCapacity }),
+    floatColumn("ram-allocatable", "RAM ALLOCATABLE (GB)", func(a NodeAllocation) float64 { return a.RAMAllocatable }),
+    floatColumn("ram-reserved", "RAM RESERVED (GB)", func(a NodeAllocation) float64 { return a.RAMReserved }),
+    floatColumn("ram-allocated", "RAM ALLOCATED (GB)", func(a NodeAllocation) float64 { return a.RAMAllocated }),
+    floatColumn("ram-allocated-pct", "RAM ALLOCATED (%)", func(a NodeAllocation) float64 { return a.RAMAllocatedPct }),
+    floatColumn("ram-available", "RAM AVAILABLE (GB)", func(a NodeAllocation) float64 { return a.RAMAvailable }),
+    floatColumn("ram-limits", "RAM LIMITS (GB)", func(a NodeAllocation) float64 { return a.RAMLimits }),
+    floatColumn("ram-overcommit", "RAM OVERCOMMIT", func(a NodeAllocation) float64 { return a.RAMOvercommit }),
+}
+
+var cpuUsageColumns = []tableColumn{
+    floatColumn("cpu-usage", "CPU USAGE (Cores)", func(a NodeAllocation) float64 { return a.CPUUsage }),
+    floatColumn("cpu-usage-request-pct", "CPU USAGE/REQUESTS (%)", func(a NodeAllocation) float64 { return a.CPUUsageRequestPct }),
+    floatColumn("cpu-usage-allocatable-pct", "CPU USAGE/ALLOCATABLE (%)", func(a NodeAllocation) float64 { return a.CPUUsageAllocatablePct }),
+}
+
+var ramUsageColumns = []tableColumn{
+    floatColumn("ram-usage", "RAM USAGE (GB)", func(a NodeAllocation) float64 { return a.RAMUsage }),
+    floatColumn("ram-usage-request-pct", "RAM USAGE/REQUESTS (%)", func(a NodeAllocation) float64 { return a.RAMUsageRequestPct }),
+    floatColumn("ram-usage-allocatable-pct", "RAM USAGE/ALLOCATABLE (%)", func(a NodeAllocation) float64 { return a.RAMUsageAllocatablePct }),
+}
+
+// selectColumns returns the table columns for the sections picked by the
+// --cpu-only, --ram-only and --pods-only flags, or every column if none of
+// them is set. Usage columns are only included when usage was requested.
+func selectColumns(cpuOnly, ramOnly, podsOnly, usage bool) []tableColumn {
+    all := !cpuOnly && !ramOnly && !podsOnly
+    var columns []tableColumn
+    if all || podsOnly {
+        columns = append(columns, podColumns...)
+    }
+    if all || cpuOnly {
+        columns = append(columns, cpuColumns...)
+        if usage {
+            columns = append(columns, cpuUsageColumns...)
+        }
+    }
+    if all || ramOnly {
+        columns = append(columns, ramColumns...)
+        if usage {
+            columns = append(columns, ramUsageColumns...)
+        }
+    }
+    return columns
+}
+
+// staticColumns returns every column that does not depend on the
+// --resources flag, in table order.
+func staticColumns() []tableColumn {
+    var columns []tableColumn
+    columns = append(columns, podColumns...)
+    columns = append(columns, cpuColumns...)
+    columns = append(columns, cpuUsageColumns...)
+    columns = append(columns, ramColumns...)
+    columns = append(columns, ramUsageColumns...)
+    columns = append(columns, costColumns...)
+    return columns
+}
+
+// findColumn looks up a column by key among the static columns, the status
+// columns and the columns of the given extended resources.
+func findColumn(key string, resources []corev1.ResourceName) (tableColumn, bool) {
+    columns := append(staticColumns(), statusColumns...)
+    for _, column := range append(columns, resourceColumns(resources)...) {
+        if column.Key == key {
+            return column, true
+        }
+    }
+    return tableColumn{}, false
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "text/tabwriter"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConsolidationNode is a node the consolidation plan considered. Removable
+// nodes list how many pods would move off them; kept nodes say why they
+// have to stay.
+type ConsolidationNode struct {
+    NodeName  string  `json:"node_name" yaml:"node_name"`
+    Removable bool    `json:"removable" yaml:"removable"`
+    CPUCores  float64 `json:"cpu_cores" yaml:"cpu_cores"`
+    MemoryGiB float64 `json:"memory_gib" yaml:"memory_gib"`
+    PodsMoved int     `json:"pods_moved" yaml:"pods_moved"`
+    Reason    string  `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// ConsolidationReport is the result of the consolidate command. The
+// savings are the basis resources of the removable nodes.
+type ConsolidationReport struct {
+    Basis          string              `json:"basis" yaml:"basis"`
+    TotalNodes     int                 `json:"total_nodes" yaml:"total_nodes"`
+    RemovableNodes int                 `json:"removable_nodes" yaml:"removable_nodes"`
+    SavedCPUCores  float64             `json:"saved_cpu_cores" yaml:"saved_cpu_cores"`
+    SavedMemoryGiB float64             `json:"saved_memory_gib" yaml:"saved_memory_gib"`
+    Nodes          []ConsolidationNode `json:"nodes" yaml:"nodes"`
+}
+
+func runConsolidate(args []string) {
+    fs := flag.NewFlagSet("consolidate", flag.ExitOnError)
+    kubeconfig := fs.String("kubeconfig", "", "absolute path to the kubeconfig file")
+    contextName := fs.String("context", "", "name of the kubeconfig context to use")
+    outputFormat := fs.String("output", "table", "output format: table, json, yaml (use -o for short form)")
+    noHeaders := fs.Bool("no-headers", false, "if true, omit header row in output")
+    selector := fs.String("selector", "", "label selector of the nodes to consolidate, e.g. a single node pool")
+    basis := fs.String("basis", basisAllocatable, "node resources free capacity and savings are computed from: allocatable, capacity")
+    all := fs.Bool("all", false, "if true, also list the nodes that have to stay and why")
+    nodesFile := fs.String("nodes-file", "", "read nodes from this JSON/YAML file or directory instead of the API server")
+    podsFile := fs.String("pods-file", "", "read pods from this JSON/YAML file or directory instead of the API server")
+
+    // Short flags
+    outputFlag := fs.String("o", "table", "output format: table, json, yaml")
+    selectorFlag := fs.String("l", "", "label selector of the nodes to consolidate")
+
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kubectl pod-capacity consolidate [flags]\n\n")
+        fmt.Fprintf(os.Stderr, "This command finds nodes whose pods could all be moved onto the other nodes, emptiest nodes first, and estimates what removing them would save. Nothing in the cluster is changed\n\n")
+        fmt.Fprintf(os.Stderr, "Flags:\n")
+        fmt.Fprintf(os.Stderr, "  -l, --selector string    label selector of the nodes to consolidate, e.g. a single node pool\n")
+        fmt.Fprintf(os.Stderr, "  -o, --output string      output format: table, json, yaml\n")
+        fmt.Fprintf(os.Stderr, "  --all                    if true, also list the nodes that have to stay and why\n")
+        fmt.Fprintf(os.Stderr, "  --kubeconfig string      absolute path to the kubeconfig file\n")
+        fmt.Fprintf(os.Stderr, "  --context string         name of the kubeconfig context to use\n")
+        fmt.Fprintf(os.Stderr, "  --no-headers             if true, omit header row in output\n")
+        fmt.Fprintf(os.Stderr, "  --basis string           node resources free capacity and savings are computed from: allocatable, capacity (default allocatable)\n")
+        fmt.Fprintf(os.Stderr, "  --nodes-file string      read nodes from this JSON/YAML file or directory instead of the API server\n")
+        fmt.Fprintf(os.Stderr, "  --pods-file string       read pods from this JSON/YAML file or directory instead of the API server\n")
+    }
+
+    fs.Parse(args)
+
+    if *outputFlag != "table" {
+        *outputFormat = *outputFlag
+    }
+    if *selectorFlag != "" {
+        *selector = *selectorFlag
+    }
+    if *basis != basisAllocatable && *basis != basisCapacity {
+        fmt.Println("Invalid basis. Supported values: allocatable, capacity.")
+        os.Exit(1)
+    }
+
+    source := openSource(*kubeconfig, *contextName, *nodesFile, *podsFile)
+    nodes, err := source.Nodes(*selector)
+    if err != nil {
+        fmt.Printf("Error fetching nodes: %s\n", err.Error())
+        os.Exit(1)
+    }
+    pods, err := source.Pods()
+    if err != nil {
+        fmt.Printf("Error fetching pods: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    report := planConsolidation(nodes, podsByNode(pods), *basis)
+    if !*all {
+        var removable []ConsolidationNode
+        for _, node := range report.Nodes {
+            if node.Removable {
+                removable = append(removable, node)
+            }
+        }
+        report.Nodes = removable
+    }
+
+    switch *outputFormat {
+    case "json":
+        outputJSON(report)
+    case "yaml":
+        outputYAML(report)
+    case "table":
+        writeConsolidationTable(os.Stdout, report, *noHeaders)
+    default:
+        fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
+        os.Exit(1)
+    }
+}
+
+// planConsolidation greedily removes nodes, emptiest first by the larger of
+// their CPU and memory request ratios. A node is removed if every pod a
+// drain would evict from it fits on the nodes that are left, placed largest
+// first onto the fullest node that takes it; pods moved there count
+// against that node when it is considered in turn. Nodes running pods that
+// no controller would recreate are kept.
+func planConsolidation(nodes []corev1.Node, nodePods map[string][]corev1.Pod, basis string) ConsolidationReport {
+    report := ConsolidationReport{Basis: basis, TotalNodes: len(nodes)}
+    states := newNodeStates(nodes, nodePods, basis)
+    utilization := make(map[string]float64, len(states))
+    hosted := make(map[string][]*corev1.Pod, len(states))
+    for _, state := range states {
+        utilization[state.Node.Name] = requestRatio(state, basis)
+        hosted[state.Node.Name] = evictablePods(nodePods[state.Node.Name])
+    }
+    sort.SliceStable(states, func(i, j int) bool {
+        return utilization[states[i].Node.Name] < utilization[states[j].Node.Name]
+    })
+
+    removed := make(map[string]bool)
+    for i, candidate := range states {
+        basisResources := candidate.Node.Status.Allocatable
+        if basis == basisCapacity {
+            basisResources = candidate.Node.Status.Capacity
+        }
+        result := ConsolidationNode{
+            NodeName:  candidate.Node.Name,
+            CPUCores:  float64(basisResources.Cpu().MilliValue()) / 1000,
+            MemoryGiB: float64(basisResources.Memory().Value()) / (1024 * 1024 * 1024),
+        }
+
+        // Targets are the remaining nodes, fullest first
+        var targets []*nodeState
+        for j := len(states) - 1; j >= 0; j-- {
+            if j != i && !removed[states[j].Node.Name] {
+                targets = append(targets, states[j])
+            }
+        }
+
+        pods := append([]*corev1.Pod(nil), hosted[candidate.Node.Name]...)
+        sortByRequests(pods)
+        placements, reason := tryPlacePods(pods, targets)
+        if reason == "" {
+            removed[candidate.Node.Name] = true
+            for _, pod := range pods {
+                hosted[placements[pod]] = append(hosted[placements[pod]], pod)
+            }
+            result.Removable = true
+            result.PodsMoved = len(pods)
+            report.RemovableNodes++
+            report.SavedCPUCores += result.CPUCores
+            report.SavedMemoryGiB += result.MemoryGiB
+        } else {
+            result.Reason = reason
+        }
+        report.Nodes = append(report.Nodes, result)
+    }
+    return report
+}
+
+// tryPlacePods places every pod on the first target that takes it. If a
+// pod fits nowhere, the targets are left as they were and reason says
+// which pod is stuck.
+func tryPlacePods(pods []*corev1.Pod, targets []*nodeState) (placements map[*corev1.Pod]string, reason string) {
+    saved := make([]corev1.ResourceList, len(targets))
+    for i, target := range targets {
+        saved[i] = target.Free.DeepCopy()
+    }
+    restore := func() {
+        for i, target := range targets {
+            target.Free = saved[i]
+        }
+    }
+
+    placements = make(map[*corev1.Pod]string, len(pods))
+    for _, pod := range pods {
+        if metav1.GetControllerOf(pod) == nil {
+            restore()
+            return nil, fmt.Sprintf("pod %s/%s is not managed by a controller", pod.Namespace, pod.Name)
+        }
+        nodeName, _ := placePod(pod, targets)
+        if nodeName == "" {
+            restore()
+            return nil, fmt.Sprintf("pod %s/%s fits on no other node", pod.Namespace, pod.Name)
+        }
+        placements[pod] = nodeName
+    }
+    return placements, ""
+}
+
+// requestRatio returns the larger of a node's CPU and memory request
+// ratios, from the free resources left in its state.
+func requestRatio(state *nodeState, basis string) float64 {
+    basisResources := state.Node.Status.Allocatable
+    if basis == basisCapacity {
+        basisResources = state.Node.Status.Capacity
+    }
+    var highest float64
+    for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+        total := basisResources[name]
+        free := state.Free[name]
+        used := ratio(float64(total.MilliValue()-free.MilliValue()), float64(total.MilliValue()))
+        if used > highest {
+            highest = used
+        }
+    }
+    return highest
+}
+
+func writeConsolidationTable(out io.Writer, report ConsolidationReport, noHeaders bool) {
+    w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+    if !noHeaders {
+        fmt.Fprintln(w, "NODE_NAME\tREMOVABLE\tCPU_CORES\tMEMORY_GIB\tPODS_MOVED\tREASON")
+    }
+    for _, node := range report.Nodes {
+        fmt.Fprintf(w, "%s\t%t\t%.2f\t%.2f\t%d\t%s\n", node.NodeName, node.Removable, node.CPUCores, node.MemoryGiB, node.PodsMoved, node.Reason)
+    }
+    w.Flush()
+
+    fmt.Fprintf(out, "\n%d of %d nodes could be removed, saving %.2f cores and %.2f GiB of %s resources\n",
+        report.RemovableNodes, report.TotalNodes, report.SavedCPUCores, report.SavedMemoryGiB, report.Basis)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ownedPod returns a pod like testPod, controlled by the named owner.
+func ownedPod(namespace, name, nodeName, cpu, memory, ownerKind, ownerName string) corev1.Pod {
+    pod := testPod(namespace, name, nodeName, cpu, memory)
+    controller := true
+    pod.OwnerReferences = []metav1.OwnerReference{{
+        APIVersion: "apps/v1",
+        Kind:       ownerKind,
+        Name:       ownerName,
+        Controller: &controller,
+    }}
+    return pod
+}
+
+func TestPlanConsolidation(t *testing.T) {
+    nodes := []corev1.Node{
+        testNode("mid", "4", "8Gi", 110),
+        testNode("full", "4", "8Gi", 110),
+        testNode("small", "4", "8Gi", 110),
+    }
+    pods := []corev1.Pod{
+        ownedPod("default", "s", "small", "500m", "128Mi", "ReplicaSet", "web"),
+        ownedPod("default", "m-0", "mid", "1", "128Mi", "ReplicaSet", "web"),
+        ownedPod("default", "m-1", "mid", "1", "128Mi", "ReplicaSet", "web"),
+        ownedPod("default", "m-2", "mid", "500m", "128Mi", "ReplicaSet", "web"),
+        ownedPod("default", "f-0", "full", "1", "128Mi", "ReplicaSet", "web"),
+        ownedPod("default", "f-1", "full", "1", "128Mi", "ReplicaSet", "web"),
+        ownedPod("default", "f-2", "full", "1", "128Mi", "ReplicaSet", "web"),
+    }
+
+    report := planConsolidation(nodes, podsByNode(pods), basisAllocatable)
+
+    // small goes first, as the emptiest node, and its pod lands on full,
+    // the fullest node with room. That leaves no room on full for mid's
+    // pods, and full's pods plus the moved one don't fit on mid.
+    want := []ConsolidationNode{
+        {NodeName: "small", Removable: true, CPUCores: 4, MemoryGiB: 8, PodsMoved: 1},
+        {NodeName: "mid", CPUCores: 4, MemoryGiB: 8, Reason: "pod default/m-0 fits on no other node"},
+        {NodeName: "full", CPUCores: 4, MemoryGiB: 8, Reason: "pod default/f-1 fits on no other node"},
+    }
+    if !reflect.DeepEqual(report.Nodes, want) {
+        t.Errorf("got nodes %+v, want %+v", report.Nodes, want)
+    }
+    if report.TotalNodes != 3 || report.RemovableNodes != 1 || report.SavedCPUCores != 4 || report.SavedMemoryGiB != 8 {
+        t.Errorf("got totals %d/%d nodes, %.2f cores and %.2f GiB saved", report.RemovableNodes, report.TotalNodes, report.SavedCPUCores, report.SavedMemoryGiB)
+    }
+}
+
+func TestPlanConsolidationKeepsBarePods(t *testing.T) {
+    nodes := []corev1.Node{
+        testNode("busy", "4", "8Gi", 110),
+        testNode("idle", "4", "8Gi", 110),
+    }
+    pods := []corev1.Pod{
+        ownedPod("default", "web", "busy", "2", "1Gi", "ReplicaSet", "web"),
+        testPod("default", "bare", "idle", "100m", "128Mi"),
+    }
+
+    report := planConsolidation(nodes, podsByNode(pods), basisAllocatable)
+    if len(report.Nodes) != 2 {
+        t.Fatalf("got %d nodes, want 2", len(report.Nodes))
+    }
+    if idle := report.Nodes[0]; idle.NodeName != "idle" || idle.Removable || idle.Reason != "pod default/bare is not managed by a controller" {
+        t.Errorf("got %+v, want idle kept for its bare pod", idle)
+    }
+    // busy's pod fits on idle, which is kept anyway
+    if busy := report.Nodes[1]; busy.NodeName != "busy" || !busy.Removable || busy.PodsMoved != 1 {
+        t.Errorf("got %+v, want busy removable", busy)
+    }
+}
+
+func TestTryPlacePods(t *testing.T) {
+    nodes := []corev1.Node{
+        testNode("fuller", "4", "8Gi", 110),
+        testNode("emptier", "4", "8Gi", 110),
+    }
+    existing := []corev1.Pod{
+        ownedPod("default", "a", "fuller", "3", "1Gi", "ReplicaSet", "web"),
+        ownedPod("default", "b", "emptier", "1", "1Gi", "ReplicaSet", "web"),
+    }
+    targets := newNodeStates(nodes, podsByNode(existing), basisAllocatable)
+
+    fits := ownedPod("default", "fits", "", "500m", "512Mi", "ReplicaSet", "web")
+    placements, reason := tryPlacePods([]*corev1.Pod{&fits}, targets)
+    if reason != "" || placements[&fits] != "fuller" {
+        t.Errorf("got placements %v and reason %q, want the pod on the fuller node", placements, reason)
+    }
+
+    saved := []corev1.ResourceList{targets[0].Free.DeepCopy(), targets[1].Free.DeepCopy()}
+    small := ownedPod("default", "small", "", "250m", "256Mi", "ReplicaSet", "web")
+    huge := ownedPod("default", "huge", "", "4", "1Gi", "ReplicaSet", "web")
+    placements, reason = tryPlacePods([]*corev1.Pod{&small, &huge}, targets)
+    if placements != nil || reason != "pod default/huge fits on no other node" {
+        t.Errorf("got placements %v and reason %q, want huge to fit nowhere", placements, reason)
+    }
+    for i, target := range targets {
+        if !reflect.DeepEqual(target.Free, saved[i]) {
+            t.Errorf("%s: free resources %v not restored to %v", target.Node.Name, target.Free, saved[i])
+        }
+    }
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "text/tabwriter"
+
+    corev1 "k8s.io/api/core/v1"
+    policyv1 "k8s.io/api/policy/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+)
+
+// mirrorPodAnnotation marks the API server copies of static pods, which
+// are managed by the kubelet and cannot be evicted.
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// DrainedPod is where an evicted pod would be rescheduled. TargetNode is
+// empty if the pod would be left Pending, with Reason saying why.
+type DrainedPod struct {
+    Namespace  string `json:"namespace" yaml:"namespace"`
+    Name       string `json:"name" yaml:"name"`
+    NodeName   string `json:"node_name" yaml:"node_name"`
+    TargetNode string `json:"target_node,omitempty" yaml:"target_node,omitempty"`
+    Reason     string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// DrainReport is the result of the drain-sim command.
+type DrainReport struct {
+    DrainedNodes []string     `json:"drained_nodes" yaml:"drained_nodes"`
+    Pods         []DrainedPod `json:"pods" yaml:"pods"`
+    PendingPods  int          `json:"pending_pods" yaml:"pending_pods"`
+    Fits         bool         `json:"fits" yaml:"fits"`
+    Warnings     []string     `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+func runDrainSim(args []string) {
+    fs := flag.NewFlagSet("drain-sim", flag.ExitOnError)
+    kubeconfig := fs.String("kubeconfig", "", "absolute path to the kubeconfig file")
+    contextName := fs.String("context", "", "name of the kubeconfig context to use")
+    outputFormat := fs.String("output", "table", "output format: table, json, yaml (use -o for short form)")
+    noHeaders := fs.Bool("no-headers", false, "if true, omit header row in output")
+    selector := fs.String("selector", "", "label selector of the nodes to drain")
+    basis := fs.String("basis", basisAllocatable, "node resources free capacity is computed from: allocatable, capacity")
+    nodesFile := fs.String("nodes-file", "", "read nodes from this JSON/YAML file or directory instead of the API server")
+    podsFile := fs.String("pods-file", "", "read pods and PodDisruptionBudgets from this JSON/YAML file or directory instead of the API server")
+
+    // Short flags
+    outputFlag := fs.String("o", "table", "output format: table, json, yaml")
+    selectorFlag := fs.String("l", "", "label selector of the nodes to drain")
+
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kubectl pod-capacity drain-sim [flags] <node>...\n")
+        fmt.Fprintf(os.Stderr, "       kubectl pod-capacity drain-sim [flags] -l <selector>\n\n")
+        fmt.Fprintf(os.Stderr, "This command simulates draining nodes and checks whether their pods can be rescheduled onto the remaining nodes, taking node selectors, required node affinity, taints and pod slots into account\n\n")
+        fmt.Fprintf(os.Stderr, "Flags:\n")
+        fmt.Fprintf(os.Stderr, "  -l, --selector string    label selector of the nodes to drain\n")
+        fmt.Fprintf(os.Stderr, "  -o, --output string      output format: table, json, yaml\n")
+        fmt.Fprintf(os.Stderr, "  --kubeconfig string      absolute path to the kubeconfig file\n")
+        fmt.Fprintf(os.Stderr, "  --context string         name of the kubeconfig context to use\n")
+        fmt.Fprintf(os.Stderr, "  --no-headers             if true, omit header row in output\n")
+        fmt.Fprintf(os.Stderr, "  --basis string           node resources free capacity is computed from: allocatable, capacity (default allocatable)\n")
+        fmt.Fprintf(os.Stderr, "  --nodes-file string      read nodes from this JSON/YAML file or directory instead of the API server\n")
+        fmt.Fprintf(os.Stderr, "  --pods-file string       read pods and PodDisruptionBudgets from this JSON/YAML file or directory instead of the API server\n")
+    }
+
+    fs.Parse(args)
+
+    if *outputFlag != "table" {
+        *outputFormat = *outputFlag
+    }
+    if *selectorFlag != "" {
+        *selector = *selectorFlag
+    }
+    if (*selector == "") == (fs.NArg() == 0) {
+        fmt.Println("Give either the names of the nodes to drain or a label selector with -l.")
+        os.Exit(1)
+    }
+    if *basis != basisAllocatable && *basis != basisCapacity {
+        fmt.Println("Invalid basis. Supported values: allocatable, capacity.")
+        os.Exit(1)
+    }
+
+    source := openSource(*kubeconfig, *contextName, *nodesFile, *podsFile)
+
+    nodes, err := source.Nodes("")
+    if err != nil {
+        fmt.Printf("Error fetching nodes: %s\n", err.Error())
+        os.Exit(1)
+    }
+    drained, err := selectDrainedNodes(nodes, fs.Args(), *selector)
+    if err != nil {
+        fmt.Printf("Error selecting nodes: %s\n", err.Error())
+        os.Exit(1)
+    }
+    pods, err := source.Pods()
+    if err != nil {
+        fmt.Printf("Error fetching pods: %s\n", err.Error())
+        os.Exit(1)
+    }
+    // Carry on without PodDisruptionBudgets if they cannot be listed
+    pdbs, err := source.PodDisruptionBudgets()
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Warning: PodDisruptionBudgets unavailable: %s\n", err.Error())
+    }
+
+    report := simulateDrain(nodes, drained, podsByNode(pods), pdbs, *basis)
+
+    switch *outputFormat {
+    case "json":
+        outputJSON(report)
+    case "yaml":
+        outputYAML(report)
+    case "table":
+        writeDrainTable(os.Stdout, report, *noHeaders)
+    default:
+        fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
+        os.Exit(1)
+    }
+}
+
+// selectDrainedNodes returns the set of nodes to drain, either by name or by
+// label selector. Every named node must exist.
+func selectDrainedNodes(nodes []corev1.Node, names []string, selector string) (map[string]bool, error) {
+    drained := make(map[string]bool)
+    if selector != "" {
+        parsed, err := labels.Parse(selector)
+        if err != nil {
+            return nil, err
+        }
+        for _, node := range nodes {
+            if parsed.Matches(labels.Set(node.Labels)) {
+                drained[node.Name] = true
+            }
+        }
+        if len(drained) == 0 {
+            return nil, fmt.Errorf("no node matches %q", selector)
+        }
+        return drained, nil
+    }
+
+    known := make(map[string]bool, len(nodes))
+    for _, node := range nodes {
+        known[node.Name] = true
+    }
+    for _, name := range names {
+        if !known[name] {
+            return nil, fmt.Errorf("node %q not found", name)
+        }
+        drained[name] = true
+    }
+    return drained, nil
+}
+
+// simulateDrain evicts the pods of the drained nodes the way `kubectl drain`
+// would, skipping DaemonSet and static pods, and bin-packs them onto the
+// remaining nodes, largest effective request first, each onto the first
+// node with room that it is allowed to run on. Pods not managed by a
+// controller are deleted rather than recreated, so they are reported
+// without a target. PodDisruptionBudgets do not stop the simulation but
+// are reported as warnings when the drain would need more disruptions
+// than they currently allow.
+func simulateDrain(nodes []corev1.Node, drained map[string]bool, nodePods map[string][]corev1.Pod, pdbs []policyv1.PodDisruptionBudget, basis string) DrainReport {
+    var report DrainReport
+    var remaining []corev1.Node
+    for _, node := range nodes {
+        if drained[node.Name] {
+            report.DrainedNodes = append(report.DrainedNodes, node.Name)
+        } else {
+            remaining = append(remaining, node)
+        }
+    }
+    sort.Strings(report.DrainedNodes)
+    states := newNodeStates(remaining, nodePods, basis)
+
+    var evicted []*corev1.Pod
+    for _, nodeName := range report.DrainedNodes {
+        evicted = append(evicted, evictablePods(nodePods[nodeName])...)
+    }
+    report.Warnings = append(report.Warnings, pdbWarnings(evicted, pdbs)...)
+    sortByRequests(evicted)
+
+    for _, pod := range evicted {
+        result := DrainedPod{Namespace: pod.Namespace, Name: pod.Name, NodeName: pod.Spec.NodeName}
+        if metav1.GetControllerOf(pod) == nil {
+            result.Reason = "not managed by a controller, would be deleted and not recreated"
+            report.Warnings = append(report.Warnings, fmt.Sprintf("pod %s/%s is not managed by a controller; kubectl drain needs --force and the pod will not come back", pod.Namespace, pod.Name))
+        } else {
+            result.TargetNode, result.Reason = placePod(pod, states)
+            if result.TargetNode == "" {
+                report.PendingPods++
+            }
+        }
+        report.Pods = append(report.Pods, result)
+    }
+    report.Fits = report.PendingPods == 0
+    return report
+}
+
+// evictablePods returns the pods a drain would evict from a node: all but
+// terminated pods, static pods and pods owned by a DaemonSet, which stay
+// with the node.
+func evictablePods(pods []corev1.Pod) []*corev1.Pod {
+    var evicted []*corev1.Pod
+    for i := range pods {
+        pod := &pods[i]
+        if isTerminated(pod) || pod.Annotations[mirrorPodAnnotation] != "" {
+            continue
+        }
+        owner := metav1.GetControllerOf(pod)
+        if owner != nil && owner.Kind == "DaemonSet" {
+            continue
+        }
+        evicted = append(evicted, pod)
+    }
+    return evicted
+}
+
+// sortByRequests orders pods by effective CPU request, then memory request,
+// largest first, so that the hardest pods are placed while there is the
+// most room.
+func sortByRequests(pods []*corev1.Pod) {
+    sort.SliceStable(pods, func(i, j int) bool {
+        a, b := podRequests(pods[i]), podRequests(pods[j])
+        if cmp := a.Cpu().Cmp(*b.Cpu()); cmp != 0 {
+            return cmp > 0
+        }
+        return a.Memory().Cmp(*b.Memory()) > 0
+    })
+}
+
+// placePod places a pod on the first node it fits on and returns the node's
+// name. If it fits nowhere, reason is why it does not fit on the first
+// remaining node, or that there are no nodes left.
+func placePod(pod *corev1.Pod, states []*nodeState) (nodeName, reason string) {
+    requests := placementRequests(pod)
+    for _, state := range states {
+        nodeReason := checkConstraints(pod, state.Node)
+        if nodeReason == "" {
+            if count, fitReason := fitCount(state.Free, requests); count > 0 {
+                state.place(requests)
+                return state.Node.Name, ""
+            } else {
+                nodeReason = fitReason
+            }
+        }
+        if reason == "" {
+            reason = fmt.Sprintf("%s: %s", state.Node.Name, nodeReason)
+        }
+    }
+    if reason == "" {
+        reason = "no nodes left"
+    }
+    return "", "would be left Pending, " + reason
+}
+
+// pdbWarnings reports the PodDisruptionBudgets that cover more of the
+// evicted pods than the disruptions they currently allow. As in policy/v1,
+// an empty selector covers every pod in the namespace and a missing one
+// covers none.
+func pdbWarnings(evicted []*corev1.Pod, pdbs []policyv1.PodDisruptionBudget) []string {
+    var warnings []string
+    for _, pdb := range pdbs {
+        if pdb.Spec.Selector == nil {
+            continue
+        }
+        selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+        if err != nil {
+            continue
+        }
+        var covered int32
+        for _, pod := range evicted {
+            if pod.Namespace == pdb.Namespace && selector.Matches(labels.Set(pod.Labels)) {
+                covered++
+            }
+        }
+        if covered > pdb.Status.DisruptionsAllowed {
+            warnings = append(warnings, fmt.Sprintf("PodDisruptionBudget %s/%s allows %d disruptions but the drain evicts %d of its pods; eviction would block until replacements are ready", pdb.Namespace, pdb.Name, pdb.Status.DisruptionsAllowed, covered))
+        }
+    }
+    return warnings
+}
+
+func writeDrainTable(out io.Writer, report DrainReport, noHeaders bool) {
+    w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+    if !noHeaders {
+        fmt.Fprintln(w, "NAMESPACE\tNAME\tFROM\tTO\tREASON")
+    }
+    for _, pod := range report.Pods {
+        target := pod.TargetNode
+        if target == "" {
+            target = "<none>"
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pod.Namespace, pod.Name, pod.NodeName, target, pod.Reason)
+    }
+    w.Flush()
+
+    fmt.Fprintln(out)
+    for _, warning := range report.Warnings {
+        fmt.Fprintf(out, "Warning: %s\n", warning)
+    }
+    verdict := "all evicted pods can be rescheduled"
+    if !report.Fits {
+        verdict = fmt.Sprintf("%d pods would be left Pending", report.PendingPods)
+    }
+    fmt.Fprintf(out, "Draining %d nodes evicts %d pods: %s\n", len(report.DrainedNodes), len(report.Pods), verdict)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    policyv1 "k8s.io/api/policy/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEvictablePods(t *testing.T) {
+    mirror := testPod("kube-system", "etcd", "a", "100m", "128Mi")
+    mirror.Annotations = map[string]string{mirrorPodAnnotation: "hash"}
+    completed := ownedPod("default", "job", "a", "100m", "128Mi", "Job", "job")
+    completed.Status.Phase = corev1.PodSucceeded
+    pods := []corev1.Pod{
+        ownedPod("default", "web", "a", "1", "1Gi", "ReplicaSet", "web-1"),
+        ownedPod("kube-system", "agent", "a", "100m", "128Mi", "DaemonSet", "agent"),
+        mirror,
+        completed,
+        testPod("default", "bare", "a", "100m", "128Mi"),
+    }
+
+    var got []string
+    for _, pod := range evictablePods(pods) {
+        got = append(got, pod.Name)
+    }
+    if want := []string{"web", "bare"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("got %v, want %v", got, want)
+    }
+}
+
+func TestSimulateDrain(t *testing.T) {
+    nodes := []corev1.Node{
+        testNode("a", "4", "8Gi", 10),
+        testNode("b", "4", "8Gi", 10),
+        testNode("c", "4", "8Gi", 10),
+    }
+    pods := []corev1.Pod{
+        ownedPod("default", "small", "a", "1500m", "1Gi", "ReplicaSet", "small-1"),
+        ownedPod("default", "large", "a", "2500m", "1Gi", "ReplicaSet", "large-1"),
+        ownedPod("kube-system", "agent", "a", "100m", "128Mi", "DaemonSet", "agent"),
+        testPod("default", "bare", "a", "100m", "128Mi"),
+        testPod("default", "b-load", "b", "1", "1Gi"),
+        testPod("default", "c-load", "c", "2", "1Gi"),
+    }
+
+    report := simulateDrain(nodes, map[string]bool{"a": true}, podsByNode(pods), nil, basisAllocatable)
+    if !report.Fits || report.PendingPods != 0 {
+        t.Errorf("got fits %v with %d pending pods, want every pod rescheduled", report.Fits, report.PendingPods)
+    }
+    // The largest pod is placed first, on the first node with room
+    targets := make(map[string]string)
+    for _, pod := range report.Pods {
+        targets[pod.Name] = pod.TargetNode
+    }
+    want := map[string]string{"large": "b", "small": "c", "bare": ""}
+    if !reflect.DeepEqual(targets, want) {
+        t.Errorf("got targets %v, want %v", targets, want)
+    }
+    if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "default/bare") {
+        t.Errorf("got warnings %q, want one about the bare pod", report.Warnings)
+    }
+}
+
+func TestSimulateDrainLeavesPodsPending(t *testing.T) {
+    nodes := []corev1.Node{
+        testNode("a", "4", "8Gi", 10),
+        testNode("b", "4", "8Gi", 10),
+    }
+    pods := []corev1.Pod{
+        ownedPod("default", "web-1", "a", "2", "1Gi", "ReplicaSet", "web"),
+        ownedPod("default", "web-2", "a", "2", "1Gi", "ReplicaSet", "web"),
+        testPod("default", "b-load", "b", "3", "1Gi"),
+    }
+
+    report := simulateDrain(nodes, map[string]bool{"a": true}, podsByNode(pods), nil, basisAllocatable)
+    if report.Fits || report.PendingPods != 2 {
+        t.Fatalf("got fits %v with %d pending pods, want 2 pending", report.Fits, report.PendingPods)
+    }
+    for _, pod := range report.Pods {
+        if pod.TargetNode != "" || !strings.HasPrefix(pod.Reason, "would be left Pending, b:") {
+            t.Errorf("%s: got target %q, reason %q", pod.Name, pod.TargetNode, pod.Reason)
+        }
+    }
+}
+
+func TestPDBWarnings(t *testing.T) {
+    web := ownedPod("default", "web", "a", "1", "1Gi", "ReplicaSet", "web-1")
+    web.Labels = map[string]string{"app": "web"}
+    evicted := []*corev1.Pod{&web}
+    pdb := func(namespace string, selector *metav1.LabelSelector, allowed int32) policyv1.PodDisruptionBudget {
+        return policyv1.PodDisruptionBudget{
+            ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "budget"},
+            Spec:       policyv1.PodDisruptionBudgetSpec{Selector: selector},
+            Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: allowed},
+        }
+    }
+    matchWeb := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+    matchDB := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}
+
+    for _, test := range []struct {
+        name string
+        pdb  policyv1.PodDisruptionBudget
+        want bool
+    }{
+        {"matching selector without disruptions left", pdb("default", matchWeb, 0), true},
+        {"matching selector with a disruption left", pdb("default", matchWeb, 1), false},
+        {"selector of other pods", pdb("default", matchDB, 0), false},
+        {"other namespace", pdb("other", matchWeb, 0), false},
+        {"empty selector covers the whole namespace", pdb("default", &metav1.LabelSelector{}, 0), true},
+        {"no selector covers nothing", pdb("default", nil, 0), false},
+    } {
+        t.Run(test.name, func(t *testing.T) {
+            warnings := pdbWarnings(evicted, []policyv1.PodDisruptionBudget{test.pdb})
+            if got := len(warnings) > 0; got != test.want {
+                t.Errorf("got warnings %q, want warning: %v", warnings, test.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+
+    corev1 "k8s.io/api/core/v1"
+)
+
+// threshold is a --min-<column> or --max-<column> filter.
+type threshold struct {
+    Column tableColumn
+    Max    bool
+    Value  float64
+}
+
+// matches reports whether an allocation passes the threshold.
+func (t threshold) matches(alloc NodeAllocation) bool {
+    if t.Max {
+        return t.Column.Number(alloc) <= t.Value
+    }
+    return t.Column.Number(alloc) >= t.Value
+}
+
+// thresholdFlag is the flag.Value behind a threshold flag. Setting it adds a
+// threshold to the shared list.
+type thresholdFlag struct {
+    column     tableColumn
+    max        bool
+    thresholds *[]threshold
+}
+
+func (f *thresholdFlag) String() string {
+    return ""
+}
+
+func (f *thresholdFlag) Set(value string) error {
+    number, err := strconv.ParseFloat(value, 64)
+    if err != nil {
+        return err
+    }
+    *f.thresholds = append(*f.thresholds, threshold{Column: f.column, Max: f.max, Value: number})
+    return nil
+}
+
+// registerThresholdFlags adds a --min-<key> and a --max-<key> flag for every
+// static column and every column of the given resources, e.g.
+// --min-cpu-available, --max-ram-allocated-pct or --min-nvidia.com/gpu-available.
+func registerThresholdFlags(fs *flag.FlagSet, resources []corev1.ResourceName, thresholds *[]threshold) {
+    for _, column := range append(staticColumns(), resourceColumns(resources)...) {
+        // --resources cpu repeats keys of the static columns
+        if fs.Lookup("min-"+column.Key) != nil {
+            continue
+        }
+        fs.Var(&thresholdFlag{column: column, thresholds: thresholds}, "min-"+column.Key, "only show nodes with "+column.Key+" at or above this value")
+        fs.Var(&thresholdFlag{column: column, max: true, thresholds: thresholds}, "max-"+column.Key, "only show nodes with "+column.Key+" at or below this value")
+    }
+}
+
+// scanFlag returns the value of the named flag in args before the flag set
+// parses them, the last one winning as with the flag package. Flags that
+// depend on the value, such as the threshold flags of the --resources
+// columns, have to be registered before parsing.
+func scanFlag(args []string, name string) string {
+    found := ""
+    for i, arg := range args {
+        if arg == "--" {
+            break
+        }
+        if !strings.HasPrefix(arg, "-") {
+            continue
+        }
+        key, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+        if key != name {
+            continue
+        }
+        if hasValue {
+            found = value
+        } else if i+1 < len(args) {
+            found = args[i+1]
+        }
+    }
+    return found
+}
+
+// applyThresholds returns the allocations that pass every threshold.
+func applyThresholds(allocations []NodeAllocation, thresholds []threshold) []NodeAllocation {
+    if len(thresholds) == 0 {
+        return allocations
+    }
+    var filtered []NodeAllocation
+    for _, alloc := range allocations {
+        keep := true
+        for _, t := range thresholds {
+            if !t.matches(alloc) {
+                keep = false
+                break
+            }
+        }
+        if keep {
+            filtered = append(filtered, alloc)
+        }
+    }
+    return filtered
+}
+
+// sortOrder is a parsed --sort-by value. A leading - sorts in descending
+// order.
+type sortOrder struct {
+    Column     tableColumn
+    Descending bool
+}
+
+// parseSortBy resolves a --sort-by value to a column. node-name sorts
+// alphabetically, every other key sorts numerically.
+func parseSortBy(value string, resources []corev1.ResourceName) (*sortOrder, error) {
+    if value == "" {
+        return nil, nil
+    }
+    order := &sortOrder{}
+    key := value
+    if strings.HasPrefix(key, "-") {
+        order.Descending = true
+        key = strings.TrimPrefix(key, "-")
+    }
+    if key == "node-name" {
+        order.Column = tableColumn{Key: key, Value: func(alloc NodeAllocation) string { return alloc.NodeName }}
+        return order, nil
+    }
+    column, ok := findColumn(key, resources)
+    if !ok {
+        return nil, fmt.Errorf("unknown column %q", key)
+    }
+    order.Column = column
+    return order, nil
+}
+
+// less reports whether a sorts before b.
+func (o *sortOrder) less(a, b NodeAllocation) bool {
+    if o.Column.Number == nil {
+        if o.Descending {
+            return o.Column.Value(a) > o.Column.Value(b)
+        }
+        return o.Column.Value(a) < o.Column.Value(b)
+    }
+    if o.Descending {
+        return o.Column.Number(a) > o.Column.Number(b)
+    }
+    return o.Column.Number(a) < o.Column.Number(b)
+}
+
+// sortAllocations sorts allocations in place, keeping API order for ties.
+func sortAllocations(allocations []NodeAllocation, order *sortOrder) {
+    if order == nil {
+        return
+    }
+    sort.SliceStable(allocations, func(i, j int) bool {
+        return order.less(allocations[i], allocations[j])
+    })
+}
+
+// sortGroups sorts the groups of a report in place by their summed
+// allocation.
+func sortGroups(report *GroupReport, order *sortOrder) {
+    if order == nil {
+        return
+    }
+    sort.SliceStable(report.Groups, func(i, j int) bool {
+        return order.less(report.Groups[i].Allocation, report.Groups[j].Allocation)
+    })
+}
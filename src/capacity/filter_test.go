@@ -0,0 +1,59 @@
+package main
+
+import (
+    "flag"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestScanFlag(t *testing.T) {
+    for _, test := range []struct {
+        name string
+        args []string
+        want string
+    }{
+        {"separate value", []string{"--resources", "nvidia.com/gpu"}, "nvidia.com/gpu"},
+        {"inline value", []string{"-o", "json", "--resources=nvidia.com/gpu,ephemeral-storage"}, "nvidia.com/gpu,ephemeral-storage"},
+        {"single dash", []string{"-resources", "hugepages-2Mi"}, "hugepages-2Mi"},
+        {"last one wins", []string{"--resources", "a", "--resources=b"}, "b"},
+        {"missing", []string{"--sort-by", "resources"}, ""},
+        {"after terminator", []string{"--", "--resources", "a"}, ""},
+    } {
+        t.Run(test.name, func(t *testing.T) {
+            if got := scanFlag(test.args, "resources"); got != test.want {
+                t.Errorf("got %q, want %q", got, test.want)
+            }
+        })
+    }
+}
+
+func TestResourceThresholdFlags(t *testing.T) {
+    resources := []corev1.ResourceName{corev1.ResourceCPU, "nvidia.com/gpu"}
+    var thresholds []threshold
+    fs := flag.NewFlagSet("test", flag.ContinueOnError)
+    registerThresholdFlags(fs, resources, &thresholds)
+    if err := fs.Parse([]string{"--min-nvidia.com/gpu-available", "1", "--max-cpu-allocated-pct", "50"}); err != nil {
+        t.Fatal(err)
+    }
+
+    var nodes []corev1.Node
+    for _, gpus := range []string{"0", "2", "4"} {
+        node := testNode("gpu-"+gpus, "4", "8Gi", 10)
+        node.Status.Capacity["nvidia.com/gpu"] = resource.MustParse(gpus)
+        node.Status.Allocatable["nvidia.com/gpu"] = resource.MustParse(gpus)
+        nodes = append(nodes, node)
+    }
+    pods := []corev1.Pod{testPod("default", "busy", "gpu-4", "3", "1Gi")}
+    opts := reportOptions{Basis: basisAllocatable, Resources: resources}
+    allocations := applyThresholds(buildAllocations(nodes, podsByNode(pods), nil, opts), thresholds)
+
+    if len(allocations) != 1 || allocations[0].NodeName != "gpu-2" {
+        var names []string
+        for _, alloc := range allocations {
+            names = append(names, alloc.NodeName)
+        }
+        t.Errorf("got nodes %v, want [gpu-2]", names)
+    }
+}
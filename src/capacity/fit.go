@@ -0,0 +1,279 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "text/tabwriter"
+
+    appsv1 "k8s.io/api/apps/v1"
+    batchv1 "k8s.io/api/batch/v1"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// workload is the pod template read from a manifest, along with the replica
+// count the manifest asks for.
+type workload struct {
+    Kind     string
+    Name     string
+    Replicas int64
+    Pod      corev1.Pod
+}
+
+// NodeFit is how many replicas of a workload fit on a single node.
+type NodeFit struct {
+    NodeName string `json:"node_name" yaml:"node_name"`
+    Replicas int64  `json:"replicas" yaml:"replicas"`
+    Reason   string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// FitReport is the result of the fit command.
+type FitReport struct {
+    Kind              string            `json:"kind" yaml:"kind"`
+    Name              string            `json:"name" yaml:"name"`
+    Requests          map[string]string `json:"requests" yaml:"requests"`
+    RequestedReplicas int64             `json:"requested_replicas" yaml:"requested_replicas"`
+    FittingReplicas   int64             `json:"fitting_replicas" yaml:"fitting_replicas"`
+    Fits              bool              `json:"fits" yaml:"fits"`
+    Nodes             []NodeFit         `json:"nodes" yaml:"nodes"`
+}
+
+func runFit(args []string) {
+    fs := flag.NewFlagSet("fit", flag.ExitOnError)
+    kubeconfig := fs.String("kubeconfig", "", "absolute path to the kubeconfig file")
+    contextName := fs.String("context", "", "name of the kubeconfig context to use")
+    outputFormat := fs.String("output", "table", "output format: table, json, yaml (use -o for short form)")
+    noHeaders := fs.Bool("no-headers", false, "if true, omit header row in output")
+    selector := fs.String("selector", "", "label selector to filter nodes")
+    basis := fs.String("basis", basisAllocatable, "node resources free capacity is computed from: allocatable, capacity")
+    filename := fs.String("filename", "", "manifest of the Pod, Deployment, StatefulSet, ReplicaSet or Job to fit, - for stdin")
+    replicas := fs.Int64("replicas", 0, "number of replicas to fit (defaults to the manifest's replica count)")
+
+    // Short flags
+    outputFlag := fs.String("o", "table", "output format: table, json, yaml")
+    selectorFlag := fs.String("l", "", "label selector to filter nodes")
+    filenameFlag := fs.String("f", "", "manifest of the workload to fit, - for stdin")
+
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kubectl pod-capacity fit -f <manifest> [flags]\n\n")
+        fmt.Fprintf(os.Stderr, "This command checks how many replicas of a workload can be scheduled on the cluster's free capacity, taking node selectors, required node affinity, taints and pod slots into account\n\n")
+        fmt.Fprintf(os.Stderr, "Flags:\n")
+        fmt.Fprintf(os.Stderr, "  -f, --filename string    manifest of the Pod, Deployment, StatefulSet, ReplicaSet or Job to fit, - for stdin\n")
+        fmt.Fprintf(os.Stderr, "  --replicas int           number of replicas to fit (defaults to the manifest's replica count)\n")
+        fmt.Fprintf(os.Stderr, "  -o, --output string      output format: table, json, yaml\n")
+        fmt.Fprintf(os.Stderr, "  --kubeconfig string      absolute path to the kubeconfig file\n")
+        fmt.Fprintf(os.Stderr, "  --context string         name of the kubeconfig context to use\n")
+        fmt.Fprintf(os.Stderr, "  --no-headers             if true, omit header row in output\n")
+        fmt.Fprintf(os.Stderr, "  -l, --selector string    label selector to filter nodes\n")
+        fmt.Fprintf(os.Stderr, "  --basis string           node resources free capacity is computed from: allocatable, capacity (default allocatable)\n")
+    }
+
+    fs.Parse(args)
+
+    if *outputFlag != "table" {
+        *outputFormat = *outputFlag
+    }
+    if *selectorFlag != "" {
+        *selector = *selectorFlag
+    }
+    if *filenameFlag != "" {
+        *filename = *filenameFlag
+    }
+    if *filename == "" {
+        fmt.Println("A manifest is required, use -f <file>.")
+        os.Exit(1)
+    }
+    if *basis != basisAllocatable && *basis != basisCapacity {
+        fmt.Println("Invalid basis. Supported values: allocatable, capacity.")
+        os.Exit(1)
+    }
+
+    w, err := readWorkload(*filename)
+    if err != nil {
+        fmt.Printf("Error reading manifest: %s\n", err.Error())
+        os.Exit(1)
+    }
+    if *replicas > 0 {
+        w.Replicas = *replicas
+    }
+
+    config := buildConfig(*kubeconfig, *contextName)
+    clientset := newClientset(config)
+
+    nodes, err := listNodes(clientset, *selector)
+    if err != nil {
+        fmt.Printf("Error fetching nodes: %s\n", err.Error())
+        os.Exit(1)
+    }
+    pods, err := listPods(clientset)
+    if err != nil {
+        fmt.Printf("Error fetching pods: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    report := fitWorkload(w, newNodeStates(nodes, podsByNode(pods), *basis))
+
+    switch *outputFormat {
+    case "json":
+        outputJSON(report)
+    case "yaml":
+        outputYAML(report)
+    case "table":
+        outputFitTable(report, *noHeaders)
+    default:
+        fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
+        os.Exit(1)
+    }
+}
+
+// fitWorkload works out how many replicas of the workload each node can take
+// on top of what is already running there.
+func fitWorkload(w workload, states []*nodeState) FitReport {
+    requests := placementRequests(&w.Pod)
+    report := FitReport{
+        Kind:              w.Kind,
+        Name:              w.Name,
+        Requests:          make(map[string]string),
+        RequestedReplicas: w.Replicas,
+    }
+    for name, quantity := range requests {
+        if name != corev1.ResourcePods {
+            report.Requests[string(name)] = quantity.String()
+        }
+    }
+
+    for _, state := range states {
+        fit := NodeFit{NodeName: state.Node.Name}
+        if reason := checkConstraints(&w.Pod, state.Node); reason != "" {
+            fit.Reason = reason
+        } else {
+            fit.Replicas, fit.Reason = fitCount(state.Free, requests)
+        }
+        report.FittingReplicas += fit.Replicas
+        report.Nodes = append(report.Nodes, fit)
+    }
+    report.Fits = report.FittingReplicas >= report.RequestedReplicas
+    return report
+}
+
+func outputFitTable(report FitReport, noHeaders bool) {
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+    if !noHeaders {
+        fmt.Fprintf(w, "%-30s\t%s\t%s\n", "NODE_NAME", "REPLICAS", "REASON")
+    }
+    for _, fit := range report.Nodes {
+        fmt.Fprintf(w, "%-30s\t%d\t%s\n", fit.NodeName, fit.Replicas, fit.Reason)
+    }
+    w.Flush()
+
+    verdict := "fits"
+    if !report.Fits {
+        verdict = fmt.Sprintf("does not fit, short by %d", report.RequestedReplicas-report.FittingReplicas)
+    }
+    fmt.Printf("\n%s/%s: %d of %d requested replicas fit (%s)\n", report.Kind, report.Name, min(report.FittingReplicas, report.RequestedReplicas), report.RequestedReplicas, verdict)
+}
+
+// readWorkload reads the first Pod, Deployment, StatefulSet, ReplicaSet or
+// Job from a YAML or JSON manifest. A filename of - reads from stdin.
+func readWorkload(filename string) (workload, error) {
+    var r io.Reader = os.Stdin
+    if filename != "-" {
+        f, err := os.Open(filename)
+        if err != nil {
+            return workload{}, err
+        }
+        defer f.Close()
+        r = f
+    }
+
+    decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+    for {
+        var raw runtime.RawExtension
+        if err := decoder.Decode(&raw); err != nil {
+            if errors.Is(err, io.EOF) {
+                return workload{}, fmt.Errorf("no Pod, Deployment, StatefulSet, ReplicaSet or Job found")
+            }
+            return workload{}, err
+        }
+        if len(raw.Raw) == 0 {
+            continue
+        }
+        w, ok, err := decodeWorkload(raw.Raw)
+        if err != nil {
+            return workload{}, err
+        }
+        if ok {
+            return w, nil
+        }
+    }
+}
+
+// decodeWorkload extracts the pod template from a single JSON document. ok is
+// false if the document is not a supported kind.
+func decodeWorkload(data []byte) (w workload, ok bool, err error) {
+    var typeMeta metav1.TypeMeta
+    if err := json.Unmarshal(data, &typeMeta); err != nil {
+        return workload{}, false, err
+    }
+
+    w = workload{Kind: typeMeta.Kind, Replicas: 1}
+    var meta metav1.ObjectMeta
+    var template corev1.PodTemplateSpec
+    switch typeMeta.Kind {
+    case "Pod":
+        var pod corev1.Pod
+        if err := json.Unmarshal(data, &pod); err != nil {
+            return workload{}, false, err
+        }
+        meta, template = pod.ObjectMeta, corev1.PodTemplateSpec{ObjectMeta: pod.ObjectMeta, Spec: pod.Spec}
+    case "Deployment":
+        var deployment appsv1.Deployment
+        if err := json.Unmarshal(data, &deployment); err != nil {
+            return workload{}, false, err
+        }
+        meta, template = deployment.ObjectMeta, deployment.Spec.Template
+        if deployment.Spec.Replicas != nil {
+            w.Replicas = int64(*deployment.Spec.Replicas)
+        }
+    case "StatefulSet":
+        var statefulSet appsv1.StatefulSet
+        if err := json.Unmarshal(data, &statefulSet); err != nil {
+            return workload{}, false, err
+        }
+        meta, template = statefulSet.ObjectMeta, statefulSet.Spec.Template
+        if statefulSet.Spec.Replicas != nil {
+            w.Replicas = int64(*statefulSet.Spec.Replicas)
+        }
+    case "ReplicaSet":
+        var replicaSet appsv1.ReplicaSet
+        if err := json.Unmarshal(data, &replicaSet); err != nil {
+            return workload{}, false, err
+        }
+        meta, template = replicaSet.ObjectMeta, replicaSet.Spec.Template
+        if replicaSet.Spec.Replicas != nil {
+            w.Replicas = int64(*replicaSet.Spec.Replicas)
+        }
+    case "Job":
+        var job batchv1.Job
+        if err := json.Unmarshal(data, &job); err != nil {
+            return workload{}, false, err
+        }
+        meta, template = job.ObjectMeta, job.Spec.Template
+        if job.Spec.Parallelism != nil {
+            w.Replicas = int64(*job.Spec.Parallelism)
+        }
+    default:
+        return workload{}, false, nil
+    }
+
+    w.Name = meta.Name
+    w.Pod = corev1.Pod{ObjectMeta: template.ObjectMeta, Spec: template.Spec}
+    w.Pod.Namespace = meta.Namespace
+    return w, true, nil
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "math"
+    "os"
+    "strings"
+    "text/tabwriter"
+
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// defaultShapes are the pod shapes checked when --shapes is not given.
+const defaultShapes = "500m/1Gi,2/4Gi,8/32Gi"
+
+// podShape is a pod size given as CPU and memory requests, in millicores
+// and bytes so that shapes are counted exactly.
+type podShape struct {
+    Name      string
+    CPUMillis int64
+    RAMBytes  int64
+}
+
+// ShapeFit is how many pods of a shape fit into the free capacity of a set
+// of nodes. Fits counts what fits node by node; Ideal is what would fit if
+// the free capacity of all nodes were pooled into one.
+type ShapeFit struct {
+    Shape string `json:"shape" yaml:"shape"`
+    Fits  int64  `json:"fits" yaml:"fits"`
+    Ideal int64  `json:"ideal" yaml:"ideal"`
+}
+
+// FragmentationGroup is the fragmentation of a group of nodes. The largest
+// free node is the node with the most free CPU, then memory;
+// LargestFreeCPU and LargestFreeRAM are both free on that one node, so a
+// pod of that size fits on it. LargestShape is the largest of the checked
+// shapes that fits on some node. Score runs from 0, where every shape fits
+// as often as the pooled free capacity allows, to 1, where no shape fits
+// on any single node although the pooled capacity would take some.
+type FragmentationGroup struct {
+    Name            string            `json:"name" yaml:"name"`
+    Labels          map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+    NodeCount       int               `json:"node_count" yaml:"node_count"`
+    CPUAvailable    float64           `json:"cpu_available" yaml:"cpu_available"`
+    RAMAvailable    float64           `json:"ram_available" yaml:"ram_available"`
+    LargestFreeNode string            `json:"largest_free_node,omitempty" yaml:"largest_free_node,omitempty"`
+    LargestFreeCPU  float64           `json:"largest_free_cpu" yaml:"largest_free_cpu"`
+    LargestFreeRAM  float64           `json:"largest_free_ram" yaml:"largest_free_ram"`
+    Shapes          []ShapeFit        `json:"shapes" yaml:"shapes"`
+    LargestShape    string            `json:"largest_shape,omitempty" yaml:"largest_shape,omitempty"`
+    Score           float64           `json:"score" yaml:"score"`
+}
+
+// FragmentationReport is the output of the fragmentation command: one entry
+// per --group-by group plus the whole cluster.
+type FragmentationReport struct {
+    GroupBy []string             `json:"group_by,omitempty" yaml:"group_by,omitempty"`
+    Groups  []FragmentationGroup `json:"groups,omitempty" yaml:"groups,omitempty"`
+    Total   FragmentationGroup   `json:"total" yaml:"total"`
+}
+
+func runFragmentation(args []string) {
+    fs := flag.NewFlagSet("fragmentation", flag.ExitOnError)
+    kubeconfig := fs.String("kubeconfig", "", "absolute path to the kubeconfig file")
+    contextName := fs.String("context", "", "name of the kubeconfig context to use")
+    outputFormat := fs.String("output", "table", "output format: table, json, yaml (use -o for short form)")
+    noHeaders := fs.Bool("no-headers", false, "if true, omit header row in output")
+    selector := fs.String("selector", "", "label selector to filter nodes")
+    basis := fs.String("basis", basisAllocatable, "node resources free capacity is computed from: allocatable, capacity")
+    shapes := fs.String("shapes", defaultShapes, "comma separated pod shapes to check, each as <cpu>/<memory>")
+    groupBy := fs.String("group-by", "", "comma separated node label keys to report fragmentation per group of nodes")
+    nodesFile := fs.String("nodes-file", "", "read nodes from this JSON/YAML file or directory instead of the API server")
+    podsFile := fs.String("pods-file", "", "read pods from this JSON/YAML file or directory instead of the API server")
+
+    // Short flags
+    outputFlag := fs.String("o", "table", "output format: table, json, yaml")
+    selectorFlag := fs.String("l", "", "label selector to filter nodes")
+
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kubectl pod-capacity fragmentation [flags]\n\n")
+        fmt.Fprintf(os.Stderr, "This command shows how many pods of each shape fit into the free capacity node by node, compared with what the pooled free capacity would take\n\n")
+        fmt.Fprintf(os.Stderr, "Flags:\n")
+        fmt.Fprintf(os.Stderr, "  --shapes string          comma separated pod shapes to check, each as <cpu>/<memory> (default %s)\n", defaultShapes)
+        fmt.Fprintf(os.Stderr, "  --group-by string        comma separated node label keys to report fragmentation per group of nodes\n")
+        fmt.Fprintf(os.Stderr, "  -o, --output string      output format: table, json, yaml\n")
+        fmt.Fprintf(os.Stderr, "  --kubeconfig string      absolute path to the kubeconfig file\n")
+        fmt.Fprintf(os.Stderr, "  --context string         name of the kubeconfig context to use\n")
+        fmt.Fprintf(os.Stderr, "  --no-headers             if true, omit header row in output\n")
+        fmt.Fprintf(os.Stderr, "  -l, --selector string    label selector to filter nodes\n")
+        fmt.Fprintf(os.Stderr, "  --basis string           node resources free capacity is computed from: allocatable, capacity (default allocatable)\n")
+        fmt.Fprintf(os.Stderr, "  --nodes-file string      read nodes from this JSON/YAML file or directory instead of the API server\n")
+        fmt.Fprintf(os.Stderr, "  --pods-file string       read pods from this JSON/YAML file or directory instead of the API server\n")
+    }
+
+    fs.Parse(args)
+
+    if *outputFlag != "table" {
+        *outputFormat = *outputFlag
+    }
+    if *selectorFlag != "" {
+        *selector = *selectorFlag
+    }
+    if *basis != basisAllocatable && *basis != basisCapacity {
+        fmt.Println("Invalid basis. Supported values: allocatable, capacity.")
+        os.Exit(1)
+    }
+    parsedShapes, err := parseShapes(*shapes)
+    if err != nil {
+        fmt.Printf("Error parsing shapes: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    source := openSource(*kubeconfig, *contextName, *nodesFile, *podsFile)
+    nodes, err := source.Nodes(*selector)
+    if err != nil {
+        fmt.Printf("Error fetching nodes: %s\n", err.Error())
+        os.Exit(1)
+    }
+    pods, err := source.Pods()
+    if err != nil {
+        fmt.Printf("Error fetching pods: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    allocations := buildAllocations(nodes, podsByNode(pods), nil, reportOptions{Basis: *basis})
+    report := FragmentationReport{GroupBy: parseGroupBy(*groupBy)}
+    if len(report.GroupBy) > 0 {
+        for _, bucket := range bucketAllocations(allocations, report.GroupBy) {
+            group := fragmentation(bucket.Name, bucket.Nodes, parsedShapes)
+            group.Labels = bucket.Labels
+            report.Groups = append(report.Groups, group)
+        }
+    }
+    report.Total = fragmentation("TOTAL", allocations, parsedShapes)
+
+    switch *outputFormat {
+    case "json":
+        outputJSON(report)
+    case "yaml":
+        outputYAML(report)
+    case "table":
+        writeFragmentationTable(os.Stdout, report, parsedShapes, *noHeaders)
+    default:
+        fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
+        os.Exit(1)
+    }
+}
+
+// parseShapes parses the --shapes value, e.g. "500m/1Gi,2/4Gi". Both the
+// CPU and the memory part are Kubernetes quantities and must be positive.
+func parseShapes(value string) ([]podShape, error) {
+    var shapes []podShape
+    for _, name := range splitList(value) {
+        cpuPart, ramPart, ok := strings.Cut(name, "/")
+        if !ok {
+            return nil, fmt.Errorf("shape %q is not <cpu>/<memory>", name)
+        }
+        cpu, err := resource.ParseQuantity(cpuPart)
+        if err != nil {
+            return nil, fmt.Errorf("shape %q: %w", name, err)
+        }
+        ram, err := resource.ParseQuantity(ramPart)
+        if err != nil {
+            return nil, fmt.Errorf("shape %q: %w", name, err)
+        }
+        if cpu.Sign() <= 0 || ram.Sign() <= 0 {
+            return nil, fmt.Errorf("shape %q must request some CPU and memory", name)
+        }
+        shapes = append(shapes, podShape{Name: name, CPUMillis: cpu.MilliValue(), RAMBytes: ram.Value()})
+    }
+    if len(shapes) == 0 {
+        return nil, fmt.Errorf("no shapes given")
+    }
+    return shapes, nil
+}
+
+// fragmentation counts how often each shape fits into the available CPU,
+// RAM and pod slots of the given nodes. The largest shape is the one of
+// the given shapes with the most CPU, then memory, that fits on at least
+// one node; a bigger pod may still fit, see LargestFreeCPU. Nodes that
+// can't take new pods, see nodeSchedulable, count as full.
+func fragmentation(name string, allocations []NodeAllocation, shapes []podShape) FragmentationGroup {
+    group := FragmentationGroup{Name: name, NodeCount: len(allocations)}
+    var cpuMillis, ramBytes, podSlots int64
+    var largestCPU, largestRAM int64
+    for _, alloc := range allocations {
+        if alloc.Unschedulable {
+            continue
+        }
+        cpu, ram := freeMillis(alloc), freeBytes(alloc)
+        cpuMillis += cpu
+        ramBytes += ram
+        if group.LargestFreeNode == "" || cpu > largestCPU || (cpu == largestCPU && ram > largestRAM) {
+            group.LargestFreeNode = alloc.NodeName
+            largestCPU, largestRAM = cpu, ram
+        }
+        if alloc.AvailablePodSlots > 0 {
+            podSlots += alloc.AvailablePodSlots
+        }
+    }
+    group.CPUAvailable = float64(cpuMillis) / 1000.0
+    group.RAMAvailable = float64(ramBytes) / (1024 * 1024 * 1024)
+    group.LargestFreeCPU = float64(largestCPU) / 1000.0
+    group.LargestFreeRAM = float64(largestRAM) / (1024 * 1024 * 1024)
+
+    var largest *podShape
+    var lostShare float64
+    var scored int
+    for i, shape := range shapes {
+        fit := ShapeFit{Shape: shape.Name, Ideal: shapeCount(cpuMillis, ramBytes, podSlots, shape)}
+        for _, alloc := range allocations {
+            if alloc.Unschedulable {
+                continue
+            }
+            fit.Fits += shapeCount(freeMillis(alloc), freeBytes(alloc), alloc.AvailablePodSlots, shape)
+        }
+        group.Shapes = append(group.Shapes, fit)
+
+        if fit.Fits > 0 && (largest == nil || shape.CPUMillis > largest.CPUMillis || (shape.CPUMillis == largest.CPUMillis && shape.RAMBytes > largest.RAMBytes)) {
+            largest = &shapes[i]
+        }
+        if fit.Ideal > 0 {
+            lostShare += 1 - float64(fit.Fits)/float64(fit.Ideal)
+            scored++
+        }
+    }
+    if largest != nil {
+        group.LargestShape = largest.Name
+    }
+    group.Score = ratio(lostShare, float64(scored))
+    return group
+}
+
+// freeMillis returns the free CPU of a node in millicores, the unit
+// CPUAvailable was computed in, and 0 for an overcommitted node.
+func freeMillis(alloc NodeAllocation) int64 {
+    return max(int64(math.Round(alloc.CPUAvailable*1000)), 0)
+}
+
+// freeBytes returns the free memory of a node in bytes, the unit
+// RAMAvailable was computed in, and 0 for an overcommitted node.
+func freeBytes(alloc NodeAllocation) int64 {
+    return max(int64(math.Round(alloc.RAMAvailable*1024*1024*1024)), 0)
+}
+
+// shapeCount returns how many pods of a shape fit into the given free
+// millicores, bytes and pod slots.
+func shapeCount(cpuMillis, ramBytes, podSlots int64, shape podShape) int64 {
+    count := cpuMillis / shape.CPUMillis
+    if n := ramBytes / shape.RAMBytes; n < count {
+        count = n
+    }
+    if podSlots < count {
+        count = podSlots
+    }
+    if count < 0 {
+        return 0
+    }
+    return count
+}
+
+// writeFragmentationTable writes one row per group with a FITS/IDEAL column
+// per shape.
+func writeFragmentationTable(out io.Writer, report FragmentationReport, shapes []podShape, noHeaders bool) {
+    w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+    if !noHeaders {
+        fmt.Fprint(w, "GROUP\tNODES\tCPU_AVAILABLE\tRAM_AVAILABLE\tLARGEST_FREE_CPU\tLARGEST_FREE_RAM")
+        for _, shape := range shapes {
+            fmt.Fprintf(w, "\t%s", shape.Name)
+        }
+        fmt.Fprintln(w, "\tLARGEST_SHAPE\tSCORE")
+    }
+    for _, group := range append(report.Groups, report.Total) {
+        largest := group.LargestShape
+        if largest == "" {
+            largest = "<none>"
+        }
+        fmt.Fprintf(w, "%s\t%d\t%.2f\t%.2f\t%.2f\t%.2f", group.Name, group.NodeCount, group.CPUAvailable, group.RAMAvailable, group.LargestFreeCPU, group.LargestFreeRAM)
+        for _, fit := range group.Shapes {
+            fmt.Fprintf(w, "\t%d/%d", fit.Fits, fit.Ideal)
+        }
+        fmt.Fprintf(w, "\t%s\t%.2f\n", largest, group.Score)
+    }
+    w.Flush()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+// freeNode returns a node allocation with the given free CPU, RAM in GiB and
+// pod slots.
+func freeNode(name string, cpu, ramGiB float64, podSlots int64) NodeAllocation {
+    return NodeAllocation{NodeName: name, CPUAvailable: cpu, RAMAvailable: ramGiB, AvailablePodSlots: podSlots}
+}
+
+func TestParseShapes(t *testing.T) {
+    shapes, err := parseShapes(" 500m/1Gi, ,2/4Gi ")
+    if err != nil {
+        t.Fatalf("parseShapes: %s", err)
+    }
+    want := []podShape{{Name: "500m/1Gi", CPUMillis: 500, RAMBytes: 1 << 30}, {Name: "2/4Gi", CPUMillis: 2000, RAMBytes: 4 << 30}}
+    if !reflect.DeepEqual(shapes, want) {
+        t.Errorf("got %+v, want %+v", shapes, want)
+    }
+    for _, value := range []string{"", "2", "0/1Gi", "1/lots"} {
+        if _, err := parseShapes(value); err == nil {
+            t.Errorf("%q: expected an error", value)
+        }
+    }
+}
+
+func TestShapeCount(t *testing.T) {
+    large := podShape{Name: "2/4Gi", CPUMillis: 2000, RAMBytes: 4 << 30}
+    tests := []struct {
+        name     string
+        cpu      float64
+        ramGiB   float64
+        podSlots int64
+        shape    podShape
+        want     int64
+    }{
+        {"limited by CPU", 5, 100, 110, large, 2},
+        {"limited by memory", 100, 9, 110, large, 2},
+        {"limited by pod slots", 100, 100, 1, large, 1},
+        {"too small", 1.999, 100, 110, large, 0},
+        {"overcommitted", -1, 100, 110, large, 0},
+        {"no pod slots", 100, 100, -2, large, 0},
+        // 0.6 / 0.2 is 2.9999999999999996 in floating point
+        {"exact millicores", 0.6, 100, 110, podShape{Name: "200m/1Gi", CPUMillis: 200, RAMBytes: 1 << 30}, 3},
+        {"exact millicores, smaller", 0.3, 100, 110, podShape{Name: "100m/1Gi", CPUMillis: 100, RAMBytes: 1 << 30}, 3},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            alloc := freeNode("node", test.cpu, test.ramGiB, test.podSlots)
+            if got := shapeCount(freeMillis(alloc), freeBytes(alloc), alloc.AvailablePodSlots, test.shape); got != test.want {
+                t.Errorf("got %d, want %d", got, test.want)
+            }
+        })
+    }
+}
+
+func TestFragmentation(t *testing.T) {
+    shapes := []podShape{
+        {Name: "500m/1Gi", CPUMillis: 500, RAMBytes: 1 << 30},
+        {Name: "2/4Gi", CPUMillis: 2000, RAMBytes: 4 << 30},
+    }
+    // Pooled there are 7 cores and 24.5GiB free, but no single node has
+    // both 2 cores and 4GiB
+    cordoned := freeNode("cordoned", 16, 64, 110)
+    cordoned.Unschedulable = true
+    allocations := []NodeAllocation{
+        freeNode("a", 1.5, 8, 110),
+        freeNode("b", 1.5, 8, 110),
+        freeNode("c", 1, 8, 110),
+        freeNode("cpu-heavy", 3, 0.5, 110),
+        cordoned,
+    }
+
+    group := fragmentation("TOTAL", allocations, shapes)
+    if group.NodeCount != 5 || group.CPUAvailable != 7 || group.RAMAvailable != 24.5 {
+        t.Errorf("got %d nodes with %.2f cores and %.2fGiB free, want 5 with 7 and 24.5", group.NodeCount, group.CPUAvailable, group.RAMAvailable)
+    }
+    if group.LargestFreeNode != "cpu-heavy" || group.LargestFreeCPU != 3 || group.LargestFreeRAM != 0.5 {
+        t.Errorf("got largest free node %s with %.2f cores and %.2fGiB", group.LargestFreeNode, group.LargestFreeCPU, group.LargestFreeRAM)
+    }
+    wantShapes := []ShapeFit{
+        {Shape: "500m/1Gi", Fits: 8, Ideal: 14},
+        {Shape: "2/4Gi", Fits: 0, Ideal: 3},
+    }
+    if !reflect.DeepEqual(group.Shapes, wantShapes) {
+        t.Errorf("got shapes %+v, want %+v", group.Shapes, wantShapes)
+    }
+    if group.LargestShape != "500m/1Gi" {
+        t.Errorf("got largest shape %q, want 500m/1Gi", group.LargestShape)
+    }
+    // The mean of 1 - 8/14 and 1 - 0/3
+    if want := (1 - 8.0/14 + 1) / 2; group.Score != want {
+        t.Errorf("got score %v, want %v", group.Score, want)
+    }
+}
+
+func TestFragmentationWithoutFreeCapacity(t *testing.T) {
+    shapes := []podShape{{Name: "2/4Gi", CPUMillis: 2000, RAMBytes: 4 << 30}}
+    group := fragmentation("TOTAL", []NodeAllocation{freeNode("full", -0.5, 0, 0)}, shapes)
+    if group.LargestShape != "" || group.Score != 0 || group.LargestFreeCPU != 0 {
+        t.Errorf("got %+v, want no shape and a zero score", group)
+    }
+}
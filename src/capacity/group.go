@@ -0,0 +1,209 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+    "text/tabwriter"
+)
+
+// noLabelValue is the group value of nodes that do not carry a --group-by
+// label.
+const noLabelValue = "<none>"
+
+// GroupAllocation is the summed allocation of the nodes that share the same
+// values for the --group-by labels.
+type GroupAllocation struct {
+    Labels     map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+    NodeCount  int               `json:"node_count" yaml:"node_count"`
+    Allocation NodeAllocation    `json:"allocation" yaml:"allocation"`
+}
+
+// GroupReport is the --group-by output: one entry per group plus the
+// cluster-wide total.
+type GroupReport struct {
+    GroupBy []string          `json:"group_by" yaml:"group_by"`
+    Groups  []GroupAllocation `json:"groups" yaml:"groups"`
+    Total   GroupAllocation   `json:"total" yaml:"total"`
+}
+
+// parseGroupBy splits the comma separated --group-by value into label keys.
+func parseGroupBy(value string) []string {
+    return splitList(value)
+}
+
+// splitList splits a comma separated flag value, dropping blanks around
+// and between the items.
+func splitList(value string) []string {
+    var items []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            items = append(items, item)
+        }
+    }
+    return items
+}
+
+// groupAllocations buckets node allocations by the values of the given
+// labels and sums each bucket. Groups are ordered by their label values.
+func groupAllocations(allocations []NodeAllocation, groupBy []string, basis string) GroupReport {
+    report := GroupReport{GroupBy: groupBy}
+    for _, bucket := range bucketAllocations(allocations, groupBy) {
+        report.Groups = append(report.Groups, GroupAllocation{
+            Labels:     bucket.Labels,
+            NodeCount:  len(bucket.Nodes),
+            Allocation: sumAllocations(bucket.Name, bucket.Nodes, basis),
+        })
+    }
+    report.Total = GroupAllocation{
+        NodeCount:  len(allocations),
+        Allocation: sumAllocations("TOTAL", allocations, basis),
+    }
+    return report
+}
+
+// allocationBucket is the set of nodes that share the same values for the
+// --group-by labels. Name is the values joined by commas.
+type allocationBucket struct {
+    Name   string
+    Labels map[string]string
+    Nodes  []NodeAllocation
+}
+
+// bucketAllocations buckets node allocations by the values of the given
+// labels, ordered by those values. Nodes without a label get noLabelValue.
+func bucketAllocations(allocations []NodeAllocation, groupBy []string) []allocationBucket {
+    buckets := make(map[string]*allocationBucket)
+    for _, alloc := range allocations {
+        labels := make(map[string]string, len(groupBy))
+        values := make([]string, len(groupBy))
+        for i, key := range groupBy {
+            value, ok := alloc.Labels[key]
+            if !ok {
+                value = noLabelValue
+            }
+            labels[key] = value
+            values[i] = value
+        }
+        groupKey := strings.Join(values, "\x00")
+        if buckets[groupKey] == nil {
+            buckets[groupKey] = &allocationBucket{Name: strings.Join(values, ","), Labels: labels}
+        }
+        buckets[groupKey].Nodes = append(buckets[groupKey].Nodes, alloc)
+    }
+
+    groupKeys := make([]string, 0, len(buckets))
+    for groupKey := range buckets {
+        groupKeys = append(groupKeys, groupKey)
+    }
+    sort.Strings(groupKeys)
+
+    ordered := make([]allocationBucket, 0, len(groupKeys))
+    for _, groupKey := range groupKeys {
+        ordered = append(ordered, *buckets[groupKey])
+    }
+    return ordered
+}
+
+// sumAllocations adds up a set of node allocations into a single allocation
+// with the given name. Counts and quantities are summed; ratios and
+// percentages are recomputed from the sums rather than added. Available
+// figures only count schedulable nodes, since nothing new can use what is
+// free on the others.
+func sumAllocations(name string, allocations []NodeAllocation, basis string) NodeAllocation {
+    sum := NodeAllocation{NodeName: name}
+    var podCPUUsage, podRAMUsage float64
+    for _, alloc := range allocations {
+        sum.PodCapacity += alloc.PodCapacity
+        sum.PodAllocatable += alloc.PodAllocatable
+        sum.DeployedPodCount += alloc.DeployedPodCount
+        sum.TerminatedPodCount += alloc.TerminatedPodCount
+        sum.PodsWithoutLimits += alloc.PodsWithoutLimits
+        sum.CPUCapacity += alloc.CPUCapacity
+        sum.CPUAllocatable += alloc.CPUAllocatable
+        sum.CPUReserved += alloc.CPUReserved
+        sum.CPUAllocated += alloc.CPUAllocated
+        sum.CPULimits += alloc.CPULimits
+        sum.CPUUsage += alloc.CPUUsage
+        sum.RAMCapacity += alloc.RAMCapacity
+        sum.RAMAllocatable += alloc.RAMAllocatable
+        sum.RAMReserved += alloc.RAMReserved
+        sum.RAMAllocated += alloc.RAMAllocated
+        sum.RAMLimits += alloc.RAMLimits
+        sum.RAMUsage += alloc.RAMUsage
+        sum.HourlyCost += alloc.HourlyCost
+        sum.IdleHourlyCost += alloc.IdleHourlyCost
+        podCPUUsage += alloc.CPUUsageRequestPct / 100 * alloc.CPUAllocated
+        podRAMUsage += alloc.RAMUsageRequestPct / 100 * alloc.RAMAllocated
+        if !alloc.Unschedulable {
+            sum.AvailablePodSlots += alloc.AvailablePodSlots
+            sum.CPUAvailable += alloc.CPUAvailable
+            sum.RAMAvailable += alloc.RAMAvailable
+        }
+
+        for resourceName, resourceAlloc := range alloc.Resources {
+            if sum.Resources == nil {
+                sum.Resources = make(map[string]ResourceAllocation)
+            }
+            total := sum.Resources[resourceName]
+            total.Capacity += resourceAlloc.Capacity
+            total.Allocatable += resourceAlloc.Allocatable
+            total.Allocated += resourceAlloc.Allocated
+            if !alloc.Unschedulable {
+                total.Available += resourceAlloc.Available
+            }
+            sum.Resources[resourceName] = total
+        }
+    }
+
+    cpuBasis, ramBasis := sum.CPUAllocatable, sum.RAMAllocatable
+    if basis == basisCapacity {
+        cpuBasis, ramBasis = sum.CPUCapacity, sum.RAMCapacity
+    }
+    sum.CPUAllocatedPct = 100 * ratio(sum.CPUAllocated, cpuBasis)
+    sum.RAMAllocatedPct = 100 * ratio(sum.RAMAllocated, ramBasis)
+    sum.CPUOvercommit = ratio(sum.CPULimits, sum.CPUAllocatable)
+    sum.RAMOvercommit = ratio(sum.RAMLimits, sum.RAMAllocatable)
+    sum.CPUUsageRequestPct = 100 * ratio(podCPUUsage, sum.CPUAllocated)
+    sum.RAMUsageRequestPct = 100 * ratio(podRAMUsage, sum.RAMAllocated)
+    sum.CPUUsageAllocatablePct = 100 * ratio(sum.CPUUsage, sum.CPUAllocatable)
+    sum.RAMUsageAllocatablePct = 100 * ratio(sum.RAMUsage, sum.RAMAllocatable)
+    return sum
+}
+
+func outputGroupTable(report GroupReport, noHeaders bool, columns []tableColumn) {
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+    if !noHeaders {
+        for _, key := range report.GroupBy {
+            fmt.Fprintf(w, "%s\t", strings.ToUpper(key))
+        }
+        fmt.Fprintf(w, "NODES")
+        for _, column := range columns {
+            fmt.Fprintf(w, "\t%s", column.Header)
+        }
+        fmt.Fprintln(w)
+    }
+
+    printRow := func(group GroupAllocation, values []string) {
+        for _, value := range values {
+            fmt.Fprintf(w, "%s\t", value)
+        }
+        fmt.Fprintf(w, "%d", group.NodeCount)
+        for _, column := range columns {
+            fmt.Fprintf(w, "\t%s", column.Value(group.Allocation))
+        }
+        fmt.Fprintln(w)
+    }
+    for _, group := range report.Groups {
+        values := make([]string, len(report.GroupBy))
+        for i, key := range report.GroupBy {
+            values[i] = group.Labels[key]
+        }
+        printRow(group, values)
+    }
+    totalValues := make([]string, len(report.GroupBy))
+    totalValues[0] = "TOTAL"
+    printRow(report.Total, totalValues)
+    w.Flush()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestSumAllocationsExcludesUnschedulableFromAvailable(t *testing.T) {
+    ready := testNode("ready", "4", "8Gi", 10)
+    cordoned := testNode("cordoned", "4", "8Gi", 10)
+    cordoned.Spec.Unschedulable = true
+    for _, node := range []*corev1.Node{&ready, &cordoned} {
+        node.Status.Capacity["nvidia.com/gpu"] = resource.MustParse("2")
+        node.Status.Allocatable["nvidia.com/gpu"] = resource.MustParse("2")
+    }
+    pods := []corev1.Pod{
+        testPod("default", "a", "ready", "1", "2Gi"),
+        testPod("default", "b", "cordoned", "1", "2Gi"),
+    }
+    opts := reportOptions{Basis: basisAllocatable, Resources: []corev1.ResourceName{"nvidia.com/gpu"}}
+    allocations := buildAllocations([]corev1.Node{ready, cordoned}, podsByNode(pods), nil, opts)
+
+    sum := sumAllocations("TOTAL", allocations, basisAllocatable)
+    for _, check := range []struct {
+        name      string
+        got, want float64
+    }{
+        // Capacity and requests count every node
+        {"PodAllocatable", float64(sum.PodAllocatable), 20},
+        {"DeployedPodCount", float64(sum.DeployedPodCount), 2},
+        {"CPUAllocatable", sum.CPUAllocatable, 8},
+        {"CPUAllocated", sum.CPUAllocated, 2},
+        {"CPUAllocatedPct", sum.CPUAllocatedPct, 25},
+        {"RAMAllocatable", sum.RAMAllocatable, 16},
+        {"RAMAllocated", sum.RAMAllocated, 4},
+        {"gpu Capacity", sum.Resources["nvidia.com/gpu"].Capacity, 4},
+        {"gpu Allocatable", sum.Resources["nvidia.com/gpu"].Allocatable, 4},
+        // What is available only counts the node that takes new pods
+        {"AvailablePodSlots", float64(sum.AvailablePodSlots), 9},
+        {"CPUAvailable", sum.CPUAvailable, 3},
+        {"RAMAvailable", sum.RAMAvailable, 6},
+        {"gpu Available", sum.Resources["nvidia.com/gpu"].Available, 2},
+    } {
+        if check.got != check.want {
+            t.Errorf("%s: got %v, want %v", check.name, check.got, check.want)
+        }
+    }
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+    "fmt"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testNode returns a Ready node whose capacity and allocatable resources
+// are the given CPU, memory and pod count.
+func testNode(name, cpu, memory string, pods int64) corev1.Node {
+    resources := resourceList(cpu, memory)
+    resources[corev1.ResourcePods] = *resource.NewQuantity(pods, resource.DecimalSI)
+    return corev1.Node{
+        ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+        Status: corev1.NodeStatus{
+            Capacity:    resources,
+            Allocatable: resources.DeepCopy(),
+            Conditions: []corev1.NodeCondition{
+                {Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+            },
+        },
+    }
+}
+
+// testPod returns a running pod bound to nodeName with one container
+// requesting the given CPU and memory.
+func testPod(namespace, name, nodeName, cpu, memory string) corev1.Pod {
+    return corev1.Pod{
+        ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+        Spec: corev1.PodSpec{
+            NodeName:   nodeName,
+            Containers: []corev1.Container{testContainer("app", resourceList(cpu, memory), nil)},
+        },
+        Status: corev1.PodStatus{Phase: corev1.PodRunning},
+    }
+}
+
+// findAllocation returns the allocation of the named node.
+func findAllocation(allocations []NodeAllocation, name string) (NodeAllocation, error) {
+    for _, alloc := range allocations {
+        if alloc.NodeName == name {
+            return alloc, nil
+        }
+    }
+    return NodeAllocation{}, fmt.Errorf("no allocation for node %s", name)
+}
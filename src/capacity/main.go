@@ -5,11 +5,17 @@ import (
     "encoding/json"
     "flag"
     "fmt"
+    "io"
     "os"
+    "os/signal"
     "path/filepath"
+    "strings"
+    "syscall"
     "text/tabwriter"
+    "time"
 
     "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
     "k8s.io/client-go/tools/clientcmd"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
     corev1 "k8s.io/api/core/v1"
@@ -19,43 +25,159 @@ import (
 type NodeAllocation struct {
     NodeName            string `json:"node_name" yaml:"node_name"`
     PodCapacity       int64   `json:"pod_capacity,omitempty" yaml:"pod_capacity,omitempty"`
+    PodAllocatable    int64   `json:"pod_allocatable,omitempty" yaml:"pod_allocatable,omitempty"`
     DeployedPodCount  int64   `json:"deployed_pod_count,omitempty" yaml:"deployed_pod_count,omitempty"`
+    TerminatedPodCount int64  `json:"terminated_pod_count,omitempty" yaml:"terminated_pod_count,omitempty"`
     AvailablePodSlots int64   `json:"available_pod_slots,omitempty" yaml:"available_pod_slots,omitempty"`
+    PodsWithoutLimits int64   `json:"pods_without_limits,omitempty" yaml:"pods_without_limits,omitempty"`
     CPUCapacity       float64 `json:"cpu_capacity,omitempty" yaml:"cpu_capacity,omitempty"`
+    CPUAllocatable    float64 `json:"cpu_allocatable,omitempty" yaml:"cpu_allocatable,omitempty"`
+    CPUReserved       float64 `json:"cpu_reserved,omitempty" yaml:"cpu_reserved,omitempty"`
     CPUAllocated      float64 `json:"cpu_allocated,omitempty" yaml:"cpu_allocated,omitempty"`
+    CPUAllocatedPct   float64 `json:"cpu_allocated_pct,omitempty" yaml:"cpu_allocated_pct,omitempty"`
     CPUAvailable      float64 `json:"cpu_available,omitempty" yaml:"cpu_available,omitempty"`
+    CPULimits         float64 `json:"cpu_limits,omitempty" yaml:"cpu_limits,omitempty"`
+    CPUOvercommit     float64 `json:"cpu_overcommit,omitempty" yaml:"cpu_overcommit,omitempty"`
+    CPUUsage          float64 `json:"cpu_usage,omitempty" yaml:"cpu_usage,omitempty"`
+    CPUUsageRequestPct     float64 `json:"cpu_usage_request_pct,omitempty" yaml:"cpu_usage_request_pct,omitempty"`
+    CPUUsageAllocatablePct float64 `json:"cpu_usage_allocatable_pct,omitempty" yaml:"cpu_usage_allocatable_pct,omitempty"`
     RAMCapacity       float64 `json:"ram_capacity,omitempty" yaml:"ram_capacity,omitempty"`
+    RAMAllocatable    float64 `json:"ram_allocatable,omitempty" yaml:"ram_allocatable,omitempty"`
+    RAMReserved       float64 `json:"ram_reserved,omitempty" yaml:"ram_reserved,omitempty"`
     RAMAllocated      float64 `json:"ram_allocated,omitempty" yaml:"ram_allocated,omitempty"`
+    RAMAllocatedPct   float64 `json:"ram_allocated_pct,omitempty" yaml:"ram_allocated_pct,omitempty"`
     RAMAvailable      float64 `json:"ram_available,omitempty" yaml:"ram_available,omitempty"`
+    RAMLimits         float64 `json:"ram_limits,omitempty" yaml:"ram_limits,omitempty"`
+    RAMOvercommit     float64 `json:"ram_overcommit,omitempty" yaml:"ram_overcommit,omitempty"`
+    RAMUsage          float64 `json:"ram_usage,omitempty" yaml:"ram_usage,omitempty"`
+    RAMUsageRequestPct     float64 `json:"ram_usage_request_pct,omitempty" yaml:"ram_usage_request_pct,omitempty"`
+    RAMUsageAllocatablePct float64 `json:"ram_usage_allocatable_pct,omitempty" yaml:"ram_usage_allocatable_pct,omitempty"`
+    Resources         map[string]ResourceAllocation `json:"resources,omitempty" yaml:"resources,omitempty"`
+    HourlyCost        float64 `json:"hourly_cost,omitempty" yaml:"hourly_cost,omitempty"`
+    IdleHourlyCost    float64 `json:"idle_hourly_cost,omitempty" yaml:"idle_hourly_cost,omitempty"`
+    Status            string   `json:"status,omitempty" yaml:"status,omitempty"`
+    Taints            []string `json:"taints,omitempty" yaml:"taints,omitempty"`
+    Unschedulable     bool     `json:"unschedulable,omitempty" yaml:"unschedulable,omitempty"`
+    Labels            map[string]string `json:"-" yaml:"-"`
 }
 
 func main() {
+    // Subcommands
+    if len(os.Args) > 1 {
+        switch os.Args[1] {
+        case "fit":
+            runFit(os.Args[2:])
+            return
+        case "serve":
+            runServe(os.Args[2:])
+            return
+        case "diff":
+            runDiff(os.Args[2:])
+            return
+        case "drain-sim":
+            runDrainSim(os.Args[2:])
+            return
+        case "consolidate":
+            runConsolidate(os.Args[2:])
+            return
+        case "fragmentation":
+            runFragmentation(os.Args[2:])
+            return
+        case "recommend":
+            runRecommend(os.Args[2:])
+            return
+        case "pending":
+            runPending(os.Args[2:])
+            return
+        }
+    }
+
     // Command-line flags
     kubeconfig := flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
     contextName := flag.String("context", "", "name of the kubeconfig context to use")
+    contexts := flag.String("contexts", "", "comma separated list of kubeconfig contexts to query concurrently and report side by side")
+    allContexts := flag.Bool("all-contexts", false, "if true, query every context in the kubeconfig file concurrently and report side by side")
     outputFormat := flag.String("output", "table", "output format: table, json, yaml (use -o for short form)")
     noHeaders := flag.Bool("no-headers", false, "if true, omit header row in output")
     selector := flag.String("selector", "", "label selector to filter nodes")
     cpuOnly := flag.Bool("cpu-only", false, "if true, show only CPU data")
     ramOnly := flag.Bool("ram-only", false, "if true, show only RAM data")
     podsOnly := flag.Bool("pods-only", false, "if true, show only pod data")
+    includeTerminated := flag.Bool("include-terminated", false, "if true, count Succeeded and Failed pods towards pod counts and allocations")
+    resourceNames := flag.String("resources", "", "comma separated list of additional resources to report, e.g. nvidia.com/gpu,ephemeral-storage,hugepages-2Mi")
+    showUsage := flag.Bool("usage", false, "if true, add CPU and RAM usage from the metrics.k8s.io API")
+    basis := flag.String("basis", basisAllocatable, "node resources the available figures are computed from: allocatable, capacity")
+    groupByLabels := flag.String("group-by", "", "comma separated list of node labels to sum nodes by, e.g. topology.kubernetes.io/zone")
+    sortBy := flag.String("sort-by", "", "column to sort by, e.g. cpu-available; prefix with - to sort in descending order")
+    top := flag.Int("top", 0, "if set, show only the first N rows after sorting")
+    watch := flag.Bool("watch", false, "if true, keep running and redraw the table whenever allocations change")
+    watchInterval := flag.Duration("watch-interval", 2*time.Second, "minimum time between two redraws in watch mode")
+    by := flag.String("by", byNode, "what to report allocations for: node, namespace")
+    nodeName := flag.String("node", "", "if set, list the pods on this node and what they take from it instead of the node table")
+    interactive := flag.Bool("interactive", false, "if true, browse nodes, their pods and the pods' workloads in a terminal UI")
+    nodesFile := flag.String("nodes-file", "", "read nodes from this JSON/YAML file or directory instead of the API server")
+    podsFile := flag.String("pods-file", "", "read pods from this JSON/YAML file or directory instead of the API server")
+    save := flag.String("save", "", "if set, also save the node report to this file as a snapshot for the diff command")
+    schedulableOnly := flag.Bool("schedulable-only", false, "if true, leave out nodes that are cordoned, not Ready, under pressure or tainted NoSchedule/NoExecute")
+    pricing := flag.String("pricing", "", "YAML or JSON file of hourly node prices by node label, to report node costs, idle spend and namespace costs")
+    var thresholds []threshold
+    registerThresholdFlags(flag.CommandLine, parseResourceNames(scanFlag(os.Args[1:], "resources")), &thresholds)
 
     // Short output flag
     outputFlag := flag.String("o", "table", "output format: table, json, yaml")
     selectorFlag := flag.String("l", "", "label selector to filter nodes")
+    watchFlag := flag.Bool("w", false, "if true, keep running and redraw the table whenever allocations change")
+    interactiveFlag := flag.Bool("i", false, "if true, browse nodes, their pods and the pods' workloads in a terminal UI")
 
     flag.Usage = func() {
-        fmt.Fprintf(os.Stderr, "Usage: kubectl pod-capacity [flags]\n\n")
+        fmt.Fprintf(os.Stderr, "Usage: kubectl pod-capacity [flags]\n")
+        fmt.Fprintf(os.Stderr, "       kubectl pod-capacity <command> [flags]\n\n")
 	fmt.Fprintf(os.Stderr, "This command outputs resource usage and capacity data for nodes in your cluster. It supports exposing pod, cpu and ram data\n\n")
+        fmt.Fprintf(os.Stderr, "Commands:\n")
+        fmt.Fprintf(os.Stderr, "  fit                      check how many replicas of a workload fit on the cluster\n")
+        fmt.Fprintf(os.Stderr, "  serve                    expose node allocations as Prometheus metrics\n")
+        fmt.Fprintf(os.Stderr, "  diff                     compare snapshots saved with --save, or a snapshot with the cluster\n")
+        fmt.Fprintf(os.Stderr, "  drain-sim                check whether the pods of drained nodes can be rescheduled elsewhere\n")
+        fmt.Fprintf(os.Stderr, "  consolidate              find nodes that could be removed by packing their pods onto the others\n")
+        fmt.Fprintf(os.Stderr, "  fragmentation            show how many pods of standard shapes fit node by node\n")
+        fmt.Fprintf(os.Stderr, "  recommend                suggest container requests and limits from observed usage\n")
+        fmt.Fprintf(os.Stderr, "  pending                  list unschedulable pods with the closest node and compare demand with free capacity\n\n")
         fmt.Fprintf(os.Stderr, "Flags:\n")
         fmt.Fprintf(os.Stderr, "  -o, --output string      output format: table, json, yaml\n")
         fmt.Fprintf(os.Stderr, "  --kubeconfig string      absolute path to the kubeconfig file\n")
         fmt.Fprintf(os.Stderr, "  --context string         name of the kubeconfig context to use\n")
+        fmt.Fprintf(os.Stderr, "  --contexts string        comma separated list of kubeconfig contexts to query concurrently and report side by side\n")
+        fmt.Fprintf(os.Stderr, "  --all-contexts           if true, query every context in the kubeconfig file concurrently and report side by side\n")
         fmt.Fprintf(os.Stderr, "  --no-headers             if true, omit header row in output\n")
         fmt.Fprintf(os.Stderr, "  -l, --selector string    label selector to filter nodes\n")
+	fmt.Fprintf(os.Stderr, " --nodes-file string       read nodes from this JSON/YAML file or directory instead of the API server\n")
+	fmt.Fprintf(os.Stderr, " --pods-file string        read pods from this JSON/YAML file or directory instead of the API server\n")
+	fmt.Fprintf(os.Stderr, " --by string               what to report allocations for: node, namespace (default node)\n")
+	fmt.Fprintf(os.Stderr, " --node string             if set, list the pods on this node and what they take from it instead of the node table\n")
 	fmt.Fprintf(os.Stderr, " --cpu-only                if true, show only CPU data\n")
 	fmt.Fprintf(os.Stderr, " --ram-only                if true, show only RAM data\n")
 	fmt.Fprintf(os.Stderr, " --pods-only               if true, show only pod data\n")
+	fmt.Fprintf(os.Stderr, " --include-terminated      if true, count Succeeded and Failed pods towards pod counts and allocations\n")
+	fmt.Fprintf(os.Stderr, " --resources string        comma separated list of additional resources to report, e.g. nvidia.com/gpu,ephemeral-storage,hugepages-2Mi\n")
+	fmt.Fprintf(os.Stderr, " --usage                   if true, add CPU and RAM usage from the metrics.k8s.io API\n")
+	fmt.Fprintf(os.Stderr, " --basis string            node resources the available figures are computed from: allocatable, capacity (default allocatable)\n")
+	fmt.Fprintf(os.Stderr, " --group-by string         comma separated list of node labels to sum nodes by, e.g. topology.kubernetes.io/zone\n")
+	fmt.Fprintf(os.Stderr, " --sort-by string          column to sort by, e.g. cpu-available; prefix with - to sort in descending order\n")
+	fmt.Fprintf(os.Stderr, " --top int                 if set, show only the first N rows after sorting\n")
+	fmt.Fprintf(os.Stderr, " -w, --watch               if true, keep running and redraw the table whenever allocations change\n")
+	fmt.Fprintf(os.Stderr, " --watch-interval duration minimum time between two redraws in watch mode (default 2s)\n")
+	fmt.Fprintf(os.Stderr, " -i, --interactive         if true, browse nodes, their pods and the pods' workloads in a terminal UI\n")
+	fmt.Fprintf(os.Stderr, " --save string             if set, also save the node report to this file as a snapshot for the diff command\n")
+	fmt.Fprintf(os.Stderr, " --schedulable-only        if true, leave out nodes that are cordoned, not Ready, under pressure or tainted NoSchedule/NoExecute\n")
+	fmt.Fprintf(os.Stderr, " --pricing string          YAML or JSON file of hourly node prices by node label, to report node costs, idle spend and namespace costs\n")
+	fmt.Fprintf(os.Stderr, " --min-<column> float      only show nodes with the column at or above the value, e.g. --min-cpu-available 2\n")
+	fmt.Fprintf(os.Stderr, " --max-<column> float      only show nodes with the column at or below the value, e.g. --max-ram-allocated-pct 80\n")
+	fmt.Fprintf(os.Stderr, "                           the --resources columns take thresholds too, e.g. --resources nvidia.com/gpu --min-nvidia.com/gpu-available 1\n")
+        fmt.Fprintf(os.Stderr, "\nColumns: node-name")
+        for _, column := range staticColumns() {
+            fmt.Fprintf(os.Stderr, ", %s", column.Key)
+        }
+        fmt.Fprintf(os.Stderr, ", and <resource>-capacity, <resource>-allocated, <resource>-available for each of --resources\n")
     }
 
     flag.Parse()
@@ -67,156 +189,637 @@ func main() {
     if *selectorFlag != "" { 
         *selector = *selectorFlag
     }
+    if *watchFlag {
+        *watch = true
+    }
+    if *interactiveFlag {
+        *interactive = true
+    }
+    if *basis != basisAllocatable && *basis != basisCapacity {
+        fmt.Println("Invalid basis. Supported values: allocatable, capacity.")
+        os.Exit(1)
+    }
+    resources := parseResourceNames(*resourceNames)
+    groupBy := parseGroupBy(*groupByLabels)
+    if *watch && (*outputFormat != "table" || len(groupBy) > 0 || *showUsage) {
+        fmt.Println("Watch mode only supports the node table; it cannot be combined with -o json/yaml, --group-by or --usage.")
+        os.Exit(1)
+    }
+    if *interactive && (*watch || *outputFormat != "table" || len(groupBy) > 0) {
+        fmt.Println("Interactive mode cannot be combined with --watch, -o json/yaml or --group-by.")
+        os.Exit(1)
+    }
+    if *by != byNode && *by != byNamespace {
+        fmt.Println("Invalid --by value. Supported values: node, namespace.")
+        os.Exit(1)
+    }
+    if *by == byNamespace && (*watch || *interactive || len(groupBy) > 0 || *nodeName != "" || *sortBy != "" || *showUsage) {
+        fmt.Println("--by namespace cannot be combined with --watch, --interactive, --group-by, --node, --sort-by or --usage.")
+        os.Exit(1)
+    }
+    if *nodeName != "" && (*watch || *interactive || len(groupBy) > 0 || *sortBy != "") {
+        fmt.Println("--node cannot be combined with --watch, --interactive, --group-by or --sort-by.")
+        os.Exit(1)
+    }
+    if *save != "" && (*watch || *by == byNamespace || *nodeName != "") {
+        fmt.Println("--save cannot be combined with --watch, --by namespace or --node.")
+        os.Exit(1)
+    }
+    multiCluster := *contexts != "" || *allContexts
+    if multiCluster && (*contextName != "" || *watch || *interactive || len(groupBy) > 0 || *by == byNamespace || *nodeName != "" || *save != "" || *nodesFile != "" || *podsFile != "") {
+        fmt.Println("--contexts and --all-contexts cannot be combined with --context, --watch, --interactive, --group-by, --by namespace, --node, --save, --nodes-file or --pods-file.")
+        os.Exit(1)
+    }
+    offline := *nodesFile != "" || *podsFile != ""
+    if offline && (*watch || *showUsage) {
+        fmt.Println("--nodes-file and --pods-file cannot be combined with --watch or --usage.")
+        os.Exit(1)
+    }
+    order, err := parseSortBy(*sortBy, resources)
+    if err != nil {
+        fmt.Printf("Invalid sort column: %s\n", err.Error())
+        os.Exit(1)
+    }
+    var prices *priceTable
+    if *pricing != "" {
+        prices, err = readPriceTable(*pricing)
+        if err != nil {
+            fmt.Printf("Error reading pricing: %s\n", err.Error())
+            os.Exit(1)
+        }
+    }
+    opts := reportOptions{
+        Basis:             *basis,
+        IncludeTerminated: *includeTerminated,
+        Resources:         resources,
+        Thresholds:        thresholds,
+        Order:             order,
+        Top:               *top,
+        CPUOnly:           *cpuOnly,
+        RAMOnly:           *ramOnly,
+        PodsOnly:          *podsOnly,
+        Pricing:           prices,
+        SchedulableOnly:   *schedulableOnly,
+    }
+
+    columns := selectColumns(*cpuOnly, *ramOnly, *podsOnly, *showUsage)
+    columns = append(columns, resourceColumns(resources)...)
+    if prices != nil {
+        columns = append(columns, costColumns...)
+    }
+    if len(groupBy) == 0 {
+        columns = append(columns, statusColumns...)
+    }
 
-    // Load kubeconfig
-    if *kubeconfig == "" {
-	if kubeconfigEnv, exists := os.LookupEnv("KUBECONFIG"); exists {
-            *kubeconfig = kubeconfigEnv
-        } else {
-            homeDir, err := os.UserHomeDir()
-            if err != nil {
-                fmt.Printf("Error getting home directory: %s\n", err.Error())
-                os.Exit(1)
+    if multiCluster {
+        path := kubeconfigPath(*kubeconfig)
+        names, err := parseContexts(*contexts, *allContexts, path)
+        if err != nil {
+            fmt.Printf("Error reading kubeconfig contexts: %s\n", err.Error())
+            os.Exit(1)
+        }
+        reports := queryClusters(path, names, *selector, *showUsage, opts)
+        switch *outputFormat {
+        case "json":
+            outputJSON(reports)
+        case "yaml":
+            outputYAML(reports)
+        case "table":
+            writeClusterTable(os.Stdout, reports, *noHeaders, columns)
+        default:
+            fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
+            os.Exit(1)
+        }
+        // Report every unreachable cluster, but only after the clusters
+        // that did answer
+        failed := false
+        for _, report := range reports {
+            if len(report.Unpriced) > 0 {
+                fmt.Fprintf(os.Stderr, "Warning: no price for nodes %s in cluster %s, counting them as free\n", strings.Join(report.Unpriced, ", "), report.Context)
+            }
+            if report.UsageError != "" {
+                fmt.Fprintf(os.Stderr, "Warning: usage data unavailable in cluster %s, is metrics-server installed? %s\n", report.Context, report.UsageError)
             }
-            *kubeconfig = filepath.Join(homeDir, ".kube", "config")
+            if report.Error != "" {
+                fmt.Fprintf(os.Stderr, "Error querying cluster %s: %s\n", report.Context, report.Error)
+                failed = true
+            }
+        }
+        if failed {
+            os.Exit(1)
+        }
+        return
+    }
+
+    // Read the cluster state from the dumped files, or from the API server
+    var source clusterSource
+    var clientset kubernetes.Interface
+    if offline {
+        source, err = newFileSource(os.Stderr, *nodesFile, *podsFile)
+        if err != nil {
+            fmt.Printf("Error reading files: %s\n", err.Error())
+            os.Exit(1)
+        }
+    } else {
+        config := buildConfig(*kubeconfig, *contextName)
+        clientset = newClientset(config)
+        source = newLiveSource(config, clientset)
+    }
+
+    if *nodeName != "" {
+        node, err := source.Node(*nodeName)
+        if err != nil {
+            fmt.Printf("Error fetching node: %s\n", err.Error())
+            os.Exit(1)
         }
+        pods, err := source.NodePods(*nodeName)
+        if err != nil {
+            fmt.Printf("Error fetching pods: %s\n", err.Error())
+            os.Exit(1)
+        }
+        podAllocations := nodePodAllocations(pods, node, opts)
+        sortPodAllocations(podAllocations, podSortCPU, false)
+        if opts.Top > 0 && len(podAllocations) > opts.Top {
+            podAllocations = podAllocations[:opts.Top]
+        }
+        switch *outputFormat {
+        case "json":
+            outputJSON(podAllocations)
+        case "yaml":
+            outputYAML(podAllocations)
+        case "table":
+            writePodTable(os.Stdout, podAllocations, *noHeaders)
+        default:
+            fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
+            os.Exit(1)
+        }
+        return
+    }
+
+    if *watch {
+        ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+        defer stop()
+        if err := runWatch(ctx, os.Stdout, clientset, *selector, opts, columns, *noHeaders, *watchInterval); err != nil {
+            fmt.Printf("Error watching cluster: %s\n", err.Error())
+            os.Exit(1)
+        }
+        return
     }
 
-    config, err := clientcmd.BuildConfigFromFlags(*contextName, *kubeconfig)
+    // Fetch nodes with optional label selector
+    nodes, err := source.Nodes(*selector)
     if err != nil {
-        fmt.Printf("Error building kubeconfig: %s\n", err.Error())
+        fmt.Printf("Error fetching nodes: %s\n", err.Error())
         os.Exit(1)
     }
 
-    clientset, err := kubernetes.NewForConfig(config)
+    // Fetch all pods once and bucket them by node
+    pods, err := source.Pods()
     if err != nil {
-        fmt.Printf("Error creating Kubernetes client: %s\n", err.Error())
+        fmt.Printf("Error fetching pods: %s\n", err.Error())
         os.Exit(1)
     }
+    nodePods := podsByNode(pods)
+    if prices != nil {
+        if missing := prices.unpriced(nodes); len(missing) > 0 {
+            fmt.Fprintf(os.Stderr, "Warning: no price for nodes %s, counting them as free\n", strings.Join(missing, ", "))
+        }
+    }
 
-    // Fetch nodes with optional label selector
-    nodeListOptions := metav1.ListOptions{}
-    if *selector != "" {
-        nodeListOptions.LabelSelector = *selector
+    if *by == byNamespace {
+        // Carry on without quotas if they cannot be listed, e.g. for lack
+        // of RBAC permissions
+        quotas, err := source.ResourceQuotas()
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Warning: ResourceQuotas unavailable: %s\n", err.Error())
+        }
+        report := namespaceAllocations(nodes, nodePods, quotas, opts)
+        switch *outputFormat {
+        case "json":
+            outputJSON(report)
+        case "yaml":
+            outputYAML(report)
+        case "table":
+            writeNamespaceTable(os.Stdout, report, *noHeaders, prices != nil)
+        default:
+            fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
+            os.Exit(1)
+        }
+        return
     }
 
-    nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), nodeListOptions)
-    if err != nil {
-        fmt.Printf("Error fetching nodes: %s\n", err.Error())
-        os.Exit(1)
+    // Fetch usage from metrics-server, carrying on without it if the
+    // metrics API is not available
+    var usage map[string]nodeUsage
+    if *showUsage {
+        usage = usageOrWarn(source, pods, os.Stderr)
+        *showUsage = usage != nil
     }
 
-    var allocations []NodeAllocation
-    for _, node := range nodes.Items {
-    nodeName := node.Name
+    allocations := buildAllocations(nodes, nodePods, usage, opts)
 
-    // Get resource quantities
-    podCapacity := node.Status.Capacity[corev1.ResourcePods]
-    cpuCapacity := node.Status.Capacity[corev1.ResourceCPU]
-    ramCapacity := node.Status.Capacity[corev1.ResourceMemory]
-    // Other calculations
-    deployedPodCount := getPodCountForNode(clientset, nodeName)
-    cpuAllocated := getCPUAllocatedForNode(clientset, nodeName)
-    ramAllocated := getRAMAllocatedForNode(clientset, nodeName)
-
-    // Append to allocations
-    alloc := NodeAllocation{NodeName: nodeName}
-        if !*cpuOnly && !*ramOnly && !*podsOnly {
-            // Include all data if no specific flag is set
-            alloc.PodCapacity = podCapacity.Value()
-            alloc.DeployedPodCount = deployedPodCount
-            alloc.AvailablePodSlots = podCapacity.Value() - deployedPodCount
-            alloc.CPUCapacity = float64(cpuCapacity.MilliValue()) / 1000.0
-            alloc.CPUAllocated = float64(cpuAllocated) / 1000.0
-            alloc.RAMCapacity = float64(ramCapacity.Value()) / (1024 * 1024 * 1024)
-            alloc.RAMAllocated = float64(ramAllocated) / (1024 * 1024 * 1024)
-            alloc.CPUAvailable = float64(cpuCapacity.MilliValue()-cpuAllocated) / 1000.0
-            alloc.RAMAvailable = float64(ramCapacity.Value()-ramAllocated) / (1024 * 1024 * 1024)
-        } else {
-            if *cpuOnly {
-                alloc.CPUCapacity = float64(cpuCapacity.MilliValue()) / 1000.0
-                alloc.CPUAllocated = float64(cpuAllocated) / 1000.0
-                alloc.CPUAvailable = float64(cpuCapacity.MilliValue()-cpuAllocated) / 1000.0
-            }
-            if *ramOnly {
-                alloc.RAMCapacity = float64(ramCapacity.Value()) / (1024 * 1024 * 1024)
-                alloc.RAMAllocated = float64(ramAllocated) / (1024 * 1024 * 1024)
-                alloc.RAMAvailable = float64(ramCapacity.Value()-ramAllocated) / (1024 * 1024 * 1024)
-            }
-            if *podsOnly {
-                alloc.PodCapacity = podCapacity.Value()
-                alloc.DeployedPodCount = deployedPodCount
-                alloc.AvailablePodSlots = podCapacity.Value() - deployedPodCount
-            }
+    if *save != "" {
+        if err := saveSnapshot(*save, newSnapshot(allocations, *basis)); err != nil {
+            fmt.Printf("Error saving snapshot: %s\n", err.Error())
+            os.Exit(1)
         }
-        allocations = append(allocations, alloc)
-}
+    }
+
+    if *interactive {
+        // The terminal UI shows every section, so only --top applies here
+        allocations = topAllocations(allocations, opts)
+        if err := runInteractive(allocations, nodes, nodePods, opts); err != nil {
+            fmt.Printf("Error running interactive mode: %s\n", err.Error())
+            os.Exit(1)
+        }
+        return
+    }
+
     // Output based on the specified format
+    if len(groupBy) > 0 {
+        report := groupAllocations(allocations, groupBy, *basis)
+        finishGroups(&report, opts)
+        switch *outputFormat {
+        case "json":
+            outputJSON(report)
+        case "yaml":
+            outputYAML(report)
+        case "table":
+            outputGroupTable(report, *noHeaders, columns)
+        default:
+            fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
+            os.Exit(1)
+        }
+        return
+    }
+    allocations = finishAllocations(allocations, opts)
     switch *outputFormat {
     case "json":
         outputJSON(allocations)
     case "yaml":
         outputYAML(allocations)
     case "table":
-	outputTable(allocations, *noHeaders, *cpuOnly, *ramOnly, *podsOnly)
+	outputTable(allocations, *noHeaders, columns)
     default:
         fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
         os.Exit(1)
     }
 }
 
-func getPodCountForNode(clientset *kubernetes.Clientset, nodeName string) int64 {
-    pods, err := clientset.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
-        FieldSelector: "spec.nodeName=" + nodeName,
-    })
+// reportOptions controls how node allocations are computed, filtered and
+// ordered for output.
+type reportOptions struct {
+    Basis             string
+    IncludeTerminated bool
+    Resources         []corev1.ResourceName
+    Thresholds        []threshold
+    Order             *sortOrder
+    Top               int
+    CPUOnly           bool
+    RAMOnly           bool
+    PodsOnly          bool
+    Pricing           *priceTable
+    SchedulableOnly   bool
+}
+
+// buildAllocations computes the allocation of every node and drops the nodes
+// that fail the threshold filters, and with SchedulableOnly the nodes that
+// can't take new pods. usage is nil when usage was not requested.
+func buildAllocations(nodes []corev1.Node, nodePods map[string][]corev1.Pod, usage map[string]nodeUsage, opts reportOptions) []NodeAllocation {
+    var allocations []NodeAllocation
+    for _, node := range nodes {
+        if opts.SchedulableOnly && !nodeSchedulable(&node) {
+            continue
+        }
+        totals := aggregatePods(nodePods[node.Name], opts.IncludeTerminated)
+        alloc := newNodeAllocation(node, totals, opts.Basis, opts.Resources)
+        if opts.Pricing != nil {
+            applyPricing(&alloc, &node, opts.Pricing)
+        }
+        if usage != nil {
+            applyUsage(&alloc, usage[node.Name])
+        }
+        allocations = append(allocations, alloc)
+    }
+    return applyThresholds(allocations, opts.Thresholds)
+}
+
+// finishAllocations sorts and truncates the allocations for output and
+// keeps only the sections picked by the --*-only flags.
+func finishAllocations(allocations []NodeAllocation, opts reportOptions) []NodeAllocation {
+    allocations = topAllocations(allocations, opts)
+    for i := range allocations {
+        allocations[i] = filterAllocation(allocations[i], opts.CPUOnly, opts.RAMOnly, opts.PodsOnly)
+    }
+    return allocations
+}
+
+// topAllocations sorts the allocations by --sort-by and keeps the first
+// --top of them.
+func topAllocations(allocations []NodeAllocation, opts reportOptions) []NodeAllocation {
+    sortAllocations(allocations, opts.Order)
+    if opts.Top > 0 && len(allocations) > opts.Top {
+        allocations = allocations[:opts.Top]
+    }
+    return allocations
+}
+
+// finishGroups does the same as finishAllocations for a group report.
+func finishGroups(report *GroupReport, opts reportOptions) {
+    sortGroups(report, opts.Order)
+    if opts.Top > 0 && len(report.Groups) > opts.Top {
+        report.Groups = report.Groups[:opts.Top]
+    }
+    for i := range report.Groups {
+        report.Groups[i].Allocation = filterAllocation(report.Groups[i].Allocation, opts.CPUOnly, opts.RAMOnly, opts.PodsOnly)
+    }
+    report.Total.Allocation = filterAllocation(report.Total.Allocation, opts.CPUOnly, opts.RAMOnly, opts.PodsOnly)
+}
+
+// buildConfig loads the client configuration for the given context, or the
+// current context if empty, from the given kubeconfig file, falling back to
+// $KUBECONFIG and then ~/.kube/config.
+func buildConfig(kubeconfig, contextName string) *rest.Config {
+    config, err := contextConfig(kubeconfigPath(kubeconfig), contextName)
+    if err != nil {
+        fmt.Printf("Error building kubeconfig: %s\n", err.Error())
+        os.Exit(1)
+    }
+    return config
+}
+
+// kubeconfigPath resolves the kubeconfig file to load, falling back to
+// $KUBECONFIG and then ~/.kube/config.
+func kubeconfigPath(kubeconfig string) string {
+    if kubeconfig != "" {
+        return kubeconfig
+    }
+    if kubeconfigEnv, exists := os.LookupEnv("KUBECONFIG"); exists {
+        return kubeconfigEnv
+    }
+    homeDir, err := os.UserHomeDir()
     if err != nil {
-        fmt.Printf("Error fetching pods for node %s: %s\n", nodeName, err.Error())
-        return 0
+        fmt.Printf("Error getting home directory: %s\n", err.Error())
+        os.Exit(1)
     }
-    return int64(len(pods.Items))
+    return filepath.Join(homeDir, ".kube", "config")
+}
+
+// contextConfig builds the client configuration of a context in a
+// kubeconfig file. An empty contextName selects the current context.
+func contextConfig(path, contextName string) (*rest.Config, error) {
+    return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+        &clientcmd.ClientConfigLoadingRules{ExplicitPath: path},
+        &clientcmd.ConfigOverrides{CurrentContext: contextName},
+    ).ClientConfig()
 }
-// Function to get allocated CPU
-func getCPUAllocatedForNode(clientset *kubernetes.Clientset, nodeName string) int64 {
-    pods, err := clientset.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
-        FieldSelector: "spec.nodeName=" + nodeName,
-    })
+
+func newClientset(config *rest.Config) kubernetes.Interface {
+    clientset, err := kubernetes.NewForConfig(config)
     if err != nil {
-        fmt.Printf("Error fetching pods for node %s: %s\n", nodeName, err.Error())
-        return 0
+        fmt.Printf("Error creating Kubernetes client: %s\n", err.Error())
+        os.Exit(1)
     }
+    return clientset
+}
 
-    var totalCPUAllocated int64
-    for _, pod := range pods.Items {
-        for _, container := range pod.Spec.Containers {
-            if cpuRequest, ok := container.Resources.Requests[corev1.ResourceCPU]; ok {
-                totalCPUAllocated += cpuRequest.MilliValue() // Correct usage
-            }
+// listNodes fetches the nodes matching the optional label selector.
+func listNodes(clientset kubernetes.Interface, selector string) ([]corev1.Node, error) {
+    nodeListOptions := metav1.ListOptions{}
+    if selector != "" {
+        nodeListOptions.LabelSelector = selector
+    }
+    nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), nodeListOptions)
+    if err != nil {
+        return nil, err
+    }
+    return nodes.Items, nil
+}
+
+const (
+    basisAllocatable = "allocatable"
+    basisCapacity    = "capacity"
+)
+
+// newNodeAllocation builds the allocation report for a node from the totals
+// of the pods bound to it. Available figures are computed against the node's
+// allocatable resources or its raw capacity, depending on basis; reserved is
+// what kube-reserved, system-reserved and the eviction thresholds hold back.
+// Overcommit is always limits over allocatable, whatever the basis.
+func newNodeAllocation(node corev1.Node, totals podTotals, basis string, resources []corev1.ResourceName) NodeAllocation {
+    podCapacity := node.Status.Capacity[corev1.ResourcePods]
+    cpuCapacity := node.Status.Capacity[corev1.ResourceCPU]
+    ramCapacity := node.Status.Capacity[corev1.ResourceMemory]
+    podAllocatable := node.Status.Allocatable[corev1.ResourcePods]
+    cpuAllocatable := node.Status.Allocatable[corev1.ResourceCPU]
+    ramAllocatable := node.Status.Allocatable[corev1.ResourceMemory]
+
+    cpuAllocated := totals.Requests[corev1.ResourceCPU]
+    ramAllocated := totals.Requests[corev1.ResourceMemory]
+    cpuLimits := totals.Limits[corev1.ResourceCPU]
+    ramLimits := totals.Limits[corev1.ResourceMemory]
+
+    basisResources := node.Status.Allocatable
+    if basis == basisCapacity {
+        basisResources = node.Status.Capacity
+    }
+    podBasis := basisResources[corev1.ResourcePods]
+    cpuBasis := basisResources[corev1.ResourceCPU]
+    ramBasis := basisResources[corev1.ResourceMemory]
+
+    alloc := NodeAllocation{
+        NodeName:           node.Name,
+        PodCapacity:        podCapacity.Value(),
+        PodAllocatable:     podAllocatable.Value(),
+        DeployedPodCount:   totals.PodCount,
+        TerminatedPodCount: totals.TerminatedPodCount,
+        AvailablePodSlots:  podBasis.Value() - totals.PodCount,
+        PodsWithoutLimits:  totals.PodsWithoutLimits,
+        CPUCapacity:        float64(cpuCapacity.MilliValue()) / 1000.0,
+        CPUAllocatable:     float64(cpuAllocatable.MilliValue()) / 1000.0,
+        CPUReserved:        float64(cpuCapacity.MilliValue()-cpuAllocatable.MilliValue()) / 1000.0,
+        CPUAllocated:       float64(cpuAllocated.MilliValue()) / 1000.0,
+        CPUAllocatedPct:    100 * ratio(float64(cpuAllocated.MilliValue()), float64(cpuBasis.MilliValue())),
+        CPUAvailable:       float64(cpuBasis.MilliValue()-cpuAllocated.MilliValue()) / 1000.0,
+        CPULimits:          float64(cpuLimits.MilliValue()) / 1000.0,
+        CPUOvercommit:      ratio(float64(cpuLimits.MilliValue()), float64(cpuAllocatable.MilliValue())),
+        RAMCapacity:        float64(ramCapacity.Value()) / (1024 * 1024 * 1024),
+        RAMAllocatable:     float64(ramAllocatable.Value()) / (1024 * 1024 * 1024),
+        RAMReserved:        float64(ramCapacity.Value()-ramAllocatable.Value()) / (1024 * 1024 * 1024),
+        RAMAllocated:       float64(ramAllocated.Value()) / (1024 * 1024 * 1024),
+        RAMAllocatedPct:    100 * ratio(float64(ramAllocated.Value()), float64(ramBasis.Value())),
+        RAMAvailable:       float64(ramBasis.Value()-ramAllocated.Value()) / (1024 * 1024 * 1024),
+        RAMLimits:          float64(ramLimits.Value()) / (1024 * 1024 * 1024),
+        RAMOvercommit:      ratio(float64(ramLimits.Value()), float64(ramAllocatable.Value())),
+        Status:             nodeStatus(&node),
+        Taints:             nodeTaints(&node),
+        Unschedulable:      !nodeSchedulable(&node),
+        Labels:             node.Labels,
+    }
+
+    if len(resources) > 0 {
+        alloc.Resources = make(map[string]ResourceAllocation, len(resources))
+        for _, name := range resources {
+            alloc.Resources[string(name)] = newResourceAllocation(name, node, basisResources, totals)
         }
     }
-    return totalCPUAllocated
+    return alloc
 }
 
-// Function to get allocated RAM
-func getRAMAllocatedForNode(clientset *kubernetes.Clientset, nodeName string) int64 {
-    pods, err := clientset.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{
-        FieldSelector: "spec.nodeName=" + nodeName,
-    })
-    if err != nil {
-        fmt.Printf("Error fetching pods for node %s: %s\n", nodeName, err.Error())
-        return 0
+// filterAllocation keeps only the sections selected by the --cpu-only,
+// --ram-only and --pods-only flags. With none of them set the allocation is
+// returned unchanged.
+func filterAllocation(alloc NodeAllocation, cpuOnly, ramOnly, podsOnly bool) NodeAllocation {
+    if !cpuOnly && !ramOnly && !podsOnly {
+        return alloc
+    }
+    filtered := NodeAllocation{
+        NodeName:       alloc.NodeName,
+        Resources:      alloc.Resources,
+        HourlyCost:     alloc.HourlyCost,
+        IdleHourlyCost: alloc.IdleHourlyCost,
+        Status:         alloc.Status,
+        Taints:         alloc.Taints,
+        Unschedulable:  alloc.Unschedulable,
+        Labels:         alloc.Labels,
+    }
+    if cpuOnly {
+        filtered.CPUCapacity = alloc.CPUCapacity
+        filtered.CPUAllocatable = alloc.CPUAllocatable
+        filtered.CPUReserved = alloc.CPUReserved
+        filtered.CPUAllocated = alloc.CPUAllocated
+        filtered.CPUAllocatedPct = alloc.CPUAllocatedPct
+        filtered.CPUAvailable = alloc.CPUAvailable
+        filtered.CPULimits = alloc.CPULimits
+        filtered.CPUOvercommit = alloc.CPUOvercommit
+        filtered.CPUUsage = alloc.CPUUsage
+        filtered.CPUUsageRequestPct = alloc.CPUUsageRequestPct
+        filtered.CPUUsageAllocatablePct = alloc.CPUUsageAllocatablePct
+    }
+    if ramOnly {
+        filtered.RAMCapacity = alloc.RAMCapacity
+        filtered.RAMAllocatable = alloc.RAMAllocatable
+        filtered.RAMReserved = alloc.RAMReserved
+        filtered.RAMAllocated = alloc.RAMAllocated
+        filtered.RAMAllocatedPct = alloc.RAMAllocatedPct
+        filtered.RAMAvailable = alloc.RAMAvailable
+        filtered.RAMLimits = alloc.RAMLimits
+        filtered.RAMOvercommit = alloc.RAMOvercommit
+        filtered.RAMUsage = alloc.RAMUsage
+        filtered.RAMUsageRequestPct = alloc.RAMUsageRequestPct
+        filtered.RAMUsageAllocatablePct = alloc.RAMUsageAllocatablePct
+    }
+    if podsOnly {
+        filtered.PodCapacity = alloc.PodCapacity
+        filtered.PodAllocatable = alloc.PodAllocatable
+        filtered.DeployedPodCount = alloc.DeployedPodCount
+        filtered.TerminatedPodCount = alloc.TerminatedPodCount
+        filtered.AvailablePodSlots = alloc.AvailablePodSlots
+        filtered.PodsWithoutLimits = alloc.PodsWithoutLimits
+    }
+    return filtered
+}
+
+// podListPageSize bounds how many pods are returned per List call so that
+// large clusters are fetched in chunks rather than in a single response.
+const podListPageSize = 500
+
+// podTotals holds the per-node sums derived from the pods bound to a node.
+type podTotals struct {
+    PodCount           int64
+    TerminatedPodCount int64
+    PodsWithoutLimits  int64
+    Requests           corev1.ResourceList
+    Limits             corev1.ResourceList
+}
+
+// listPods fetches every scheduled pod in the cluster.
+func listPods(clientset kubernetes.Interface) ([]corev1.Pod, error) {
+    return listPodsMatching(clientset, "spec.nodeName!=")
+}
+
+// listPendingPods fetches the Pending pods that are not bound to a node yet.
+func listPendingPods(clientset kubernetes.Interface) ([]corev1.Pod, error) {
+    return listPodsMatching(clientset, "spec.nodeName=,status.phase=Pending")
+}
+
+// listNodePods fetches the pods bound to a single node.
+func listNodePods(clientset kubernetes.Interface, nodeName string) ([]corev1.Pod, error) {
+    return listPodsMatching(clientset, "spec.nodeName="+nodeName)
+}
+
+// listPodsMatching fetches the pods matching a field selector, following the
+// continue token until the API server has returned all pages.
+func listPodsMatching(clientset kubernetes.Interface, fieldSelector string) ([]corev1.Pod, error) {
+    var pods []corev1.Pod
+    listOptions := metav1.ListOptions{
+        FieldSelector: fieldSelector,
+        Limit:         podListPageSize,
+    }
+    for {
+        podList, err := clientset.CoreV1().Pods("").List(context.TODO(), listOptions)
+        if err != nil {
+            return nil, err
+        }
+        pods = append(pods, podList.Items...)
+        if podList.Continue == "" {
+            return pods, nil
+        }
+        listOptions.Continue = podList.Continue
     }
+}
 
-    var totalRAMAllocated int64
-    for _, pod := range pods.Items {
-        for _, container := range pod.Spec.Containers {
-            if ramRequest, ok := container.Resources.Requests[corev1.ResourceMemory]; ok {
-                totalRAMAllocated += ramRequest.Value() // Correct usage
+// podsByNode buckets pods by the node they are bound to.
+func podsByNode(pods []corev1.Pod) map[string][]corev1.Pod {
+    nodePods := make(map[string][]corev1.Pod)
+    for _, pod := range pods {
+        if pod.Spec.NodeName == "" {
+            continue
+        }
+        nodePods[pod.Spec.NodeName] = append(nodePods[pod.Spec.NodeName], pod)
+    }
+    return nodePods
+}
+
+// aggregatePods sums the pod count and the effective requests and limits of
+// every resource used by the given pods in a single pass. Terminated pods are tallied separately and,
+// unless includeTerminated is set, do not count towards the node's pods or
+// allocations, matching the kubelet's admission accounting.
+func aggregatePods(pods []corev1.Pod, includeTerminated bool) podTotals {
+    totals := podTotals{Requests: corev1.ResourceList{}, Limits: corev1.ResourceList{}}
+    for i := range pods {
+        if isTerminated(&pods[i]) {
+            totals.TerminatedPodCount++
+            if !includeTerminated {
+                continue
             }
         }
+        totals.PodCount++
+        addResourceList(totals.Requests, podRequests(&pods[i]))
+        addResourceList(totals.Limits, podLimits(&pods[i]))
+        if !hasLimits(&pods[i]) {
+            totals.PodsWithoutLimits++
+        }
     }
-    return totalRAMAllocated
+    return totals
 }
-func outputJSON(allocations []NodeAllocation) {
+
+// isTerminated reports whether a pod has reached a terminal phase. The kubelet
+// no longer reserves resources for such pods even though they remain bound
+// to the node until they are garbage collected.
+func isTerminated(pod *corev1.Pod) bool {
+    return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// ratio returns numerator/denominator, or 0 when the denominator is 0.
+func ratio(numerator, denominator float64) float64 {
+    if denominator == 0 {
+        return 0
+    }
+    return numerator / denominator
+}
+
+func outputJSON(allocations interface{}) {
     data, err := json.MarshalIndent(allocations, "", "  ")
     if err != nil {
         fmt.Printf("Error marshaling JSON: %s\n", err.Error())
@@ -225,7 +828,7 @@ func outputJSON(allocations []NodeAllocation) {
     fmt.Println(string(data))
 }
 
-func outputYAML(allocations []NodeAllocation) {
+func outputYAML(allocations interface{}) {
     data, err := yaml.Marshal(allocations)
     if err != nil {
         fmt.Printf("Error marshaling YAML: %s\n", err.Error())
@@ -234,35 +837,36 @@ func outputYAML(allocations []NodeAllocation) {
     fmt.Println(string(data))
 }
 
-func outputTable(allocations []NodeAllocation, noHeaders, cpuOnly, ramOnly, podsOnly bool) {
-    w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+func outputTable(allocations []NodeAllocation, noHeaders bool, columns []tableColumn) {
+    writeTable(os.Stdout, allocations, noHeaders, columns, nil)
+}
+
+// writeTable writes the table output to out. If decorate is set, every cell
+// is passed through it before being written, with an empty node name for the
+// header row and an empty column key for the NODE_NAME column. Any escape
+// sequences it adds must be the same length in every cell of a column to
+// keep the table aligned.
+func writeTable(out io.Writer, allocations []NodeAllocation, noHeaders bool, columns []tableColumn, decorate func(nodeName, columnKey, value string) string) {
+    cell := func(nodeName, columnKey, value string) string {
+        if decorate == nil {
+            return value
+        }
+        return decorate(nodeName, columnKey, value)
+    }
+    w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
     if !noHeaders {
-        if cpuOnly {
-            fmt.Fprintf(w, "%-30s\t%-15s\t%-15s\t%-15s\n", "NODE_NAME", "CPU CAPACITY (Cores)", "CPU ALLOCATED (Cores)", "CPU AVAILABLE (Cores)")
-        } else if ramOnly {
-            fmt.Fprintf(w, "%-30s\t%-15s\t%-15s\t%-15s\n", "NODE_NAME", "RAM CAPACITY (GB)", "RAM ALLOCATED (GB)", "RAM AVAILABLE (GB)")
-        } else if podsOnly {
-            fmt.Fprintf(w, "%-30s\t%-15s\t%-20s\t%-20s\n", "NODE_NAME", "POD CAPACITY", "DEPLOYED POD COUNT", "AVAILABLE POD SLOTS")
-        } else {
-            fmt.Fprintf(w, "%-30s\t%-15s\t%-20s\t%-20s\t%-15s\t%-15s\t%-15s\t%-15s\t%-15s\t%-15s\n",
-                "NODE_NAME", "POD CAPACITY", "DEPLOYED POD COUNT", "AVAILABLE POD SLOTS",
-                "CPU CAPACITY (Cores)", "CPU ALLOCATED (Cores)", "CPU AVAILABLE (Cores)",
-                "RAM CAPACITY (GB)", "RAM ALLOCATED (GB)", "RAM AVAILABLE (GB)")
+        fmt.Fprint(w, cell("", "", fmt.Sprintf("%-30s", "NODE_NAME")))
+        for _, column := range columns {
+            fmt.Fprintf(w, "\t%s", cell("", column.Key, column.Header))
         }
+        fmt.Fprintln(w)
     }
     for _, alloc := range allocations {
-        if cpuOnly {
-            fmt.Fprintf(w, "%-30s\t%-15.2f\t%-15.2f\t%-15.2f\n", alloc.NodeName, alloc.CPUCapacity, alloc.CPUAllocated, alloc.CPUAvailable)
-        } else if ramOnly {
-            fmt.Fprintf(w, "%-30s\t%-15.2f\t%-15.2f\t%-15.2f\n", alloc.NodeName, alloc.RAMCapacity, alloc.RAMAllocated, alloc.RAMAvailable)
-        } else if podsOnly {
-            fmt.Fprintf(w, "%-30s\t%-15d\t%-20d\t%-20d\n", alloc.NodeName, alloc.PodCapacity, alloc.DeployedPodCount, alloc.AvailablePodSlots)
-        } else {
-            fmt.Fprintf(w, "%-30s\t%-15d\t%-20d\t%-20d\t%-15.2f\t%-15.2f\t%-15.2f\t%-15.2f\t%-15.2f\t%-15.2f\n",
-                alloc.NodeName, alloc.PodCapacity, alloc.DeployedPodCount,
-                alloc.AvailablePodSlots, alloc.CPUCapacity, alloc.CPUAllocated, alloc.CPUAvailable,
-                alloc.RAMCapacity, alloc.RAMAllocated, alloc.RAMAvailable)
+        fmt.Fprint(w, cell(alloc.NodeName, "", fmt.Sprintf("%-30s", alloc.NodeName)))
+        for _, column := range columns {
+            fmt.Fprintf(w, "\t%s", cell(alloc.NodeName, column.Key, column.Value(alloc)))
         }
+        fmt.Fprintln(w)
     }
     w.Flush()
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestNewNodeAllocationOvercommitUsesAllocatable(t *testing.T) {
+    node := testNode("node", "4", "8Gi", 10)
+    node.Status.Allocatable[corev1.ResourceCPU] = resource.MustParse("3500m")
+    node.Status.Allocatable[corev1.ResourceMemory] = resource.MustParse("7Gi")
+    pod := testPod("default", "app", "node", "1", "2Gi")
+    pod.Spec.Containers[0].Resources.Limits = resourceList("7", "14Gi")
+    totals := aggregatePods([]corev1.Pod{pod}, false)
+
+    for _, basis := range []string{basisAllocatable, basisCapacity} {
+        t.Run(basis, func(t *testing.T) {
+            alloc := newNodeAllocation(node, totals, basis, nil)
+            if alloc.CPUOvercommit != 2 {
+                t.Errorf("CPUOvercommit: got %v, want 2", alloc.CPUOvercommit)
+            }
+            if alloc.RAMOvercommit != 2 {
+                t.Errorf("RAMOvercommit: got %v, want 2", alloc.RAMOvercommit)
+            }
+        })
+    }
+
+    // The available figures still follow the basis
+    alloc := newNodeAllocation(node, totals, basisCapacity, nil)
+    if alloc.CPUAvailable != 3 {
+        t.Errorf("CPUAvailable: got %v, want 3", alloc.CPUAvailable)
+    }
+    sum := sumAllocations("TOTAL", []NodeAllocation{alloc}, basisCapacity)
+    if sum.CPUOvercommit != 2 || sum.RAMOvercommit != 2 {
+        t.Errorf("summed overcommit: got %v CPU, %v RAM, want 2", sum.CPUOvercommit, sum.RAMOvercommit)
+    }
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "sort"
+    "text/tabwriter"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+)
+
+// Values of the --by flag.
+const (
+    byNode      = "node"
+    byNamespace = "namespace"
+)
+
+// QuotaAllocation is the hard limit a namespace's ResourceQuotas set on a
+// resource and what the quota controller has counted against it.
+type QuotaAllocation struct {
+    Hard float64 `json:"hard" yaml:"hard"`
+    Used float64 `json:"used" yaml:"used"`
+}
+
+// NamespaceAllocation is what the pods of a namespace take from the cluster.
+// Quota is keyed by requests.cpu, limits.cpu, requests.memory and
+// limits.memory and only holds the resources a ResourceQuota limits.
+type NamespaceAllocation struct {
+    Namespace           string                     `json:"namespace" yaml:"namespace"`
+    PodCount            int64                      `json:"pod_count" yaml:"pod_count"`
+    CPURequests         float64                    `json:"cpu_requests" yaml:"cpu_requests"`
+    CPULimits           float64                    `json:"cpu_limits" yaml:"cpu_limits"`
+    CPUSharePct         float64                    `json:"cpu_share_pct" yaml:"cpu_share_pct"`
+    RAMRequests         float64                    `json:"ram_requests" yaml:"ram_requests"`
+    RAMLimits           float64                    `json:"ram_limits" yaml:"ram_limits"`
+    RAMSharePct         float64                    `json:"ram_share_pct" yaml:"ram_share_pct"`
+    Quota               map[string]QuotaAllocation `json:"quota,omitempty" yaml:"quota,omitempty"`
+    QuotaExceedsCluster bool                       `json:"quota_exceeds_cluster,omitempty" yaml:"quota_exceeds_cluster,omitempty"`
+    HourlyCost          float64                    `json:"hourly_cost,omitempty" yaml:"hourly_cost,omitempty"`
+}
+
+// NamespaceReport is the --by namespace output: one entry per namespace plus
+// the cluster-wide total. ClusterCPU and ClusterRAM are the allocatable (or
+// capacity, depending on --basis) of the reported nodes that shares and
+// quotas are compared against. With --pricing, ClusterHourlyCost is what
+// the nodes cost and IdleHourlyCost the part no namespace requests.
+type NamespaceReport struct {
+    ClusterCPU        float64               `json:"cluster_cpu" yaml:"cluster_cpu"`
+    ClusterRAM        float64               `json:"cluster_ram" yaml:"cluster_ram"`
+    ClusterHourlyCost float64               `json:"cluster_hourly_cost,omitempty" yaml:"cluster_hourly_cost,omitempty"`
+    IdleHourlyCost    float64               `json:"idle_hourly_cost,omitempty" yaml:"idle_hourly_cost,omitempty"`
+    Namespaces        []NamespaceAllocation `json:"namespaces" yaml:"namespaces"`
+    Total             NamespaceAllocation   `json:"total" yaml:"total"`
+}
+
+// quotaKeys maps the ResourceQuota resource names capacity reports to the
+// key they are reported under; cpu and memory are shorthands for the
+// requests.
+var quotaKeys = map[corev1.ResourceName]string{
+    corev1.ResourceCPU:            string(corev1.ResourceRequestsCPU),
+    corev1.ResourceRequestsCPU:    string(corev1.ResourceRequestsCPU),
+    corev1.ResourceLimitsCPU:      string(corev1.ResourceLimitsCPU),
+    corev1.ResourceMemory:         string(corev1.ResourceRequestsMemory),
+    corev1.ResourceRequestsMemory: string(corev1.ResourceRequestsMemory),
+    corev1.ResourceLimitsMemory:   string(corev1.ResourceLimitsMemory),
+}
+
+// listResourceQuotas fetches the ResourceQuotas of every namespace.
+func listResourceQuotas(clientset kubernetes.Interface) ([]corev1.ResourceQuota, error) {
+    quotas, err := clientset.CoreV1().ResourceQuotas("").List(context.TODO(), metav1.ListOptions{})
+    if err != nil {
+        return nil, err
+    }
+    return quotas.Items, nil
+}
+
+// namespaceAllocations sums the effective requests and limits of the pods
+// on the given nodes per namespace and compares them with the cluster and
+// with each namespace's quotas. quotas is nil when they could not be
+// fetched. With pricing, each node's cost is split between the namespaces
+// by their pods' allocatedShare of the node, scaled down where the shares
+// add up to more than the whole node. Namespaces are ordered by CPU
+// requests, largest first.
+func namespaceAllocations(nodes []corev1.Node, nodePods map[string][]corev1.Pod, quotas []corev1.ResourceQuota, opts reportOptions) NamespaceReport {
+    var report NamespaceReport
+    namespaces := make(map[string]*NamespaceAllocation)
+    get := func(namespace string) *NamespaceAllocation {
+        if namespaces[namespace] == nil {
+            namespaces[namespace] = &NamespaceAllocation{Namespace: namespace}
+        }
+        return namespaces[namespace]
+    }
+
+    for _, node := range nodes {
+        if opts.SchedulableOnly && !nodeSchedulable(&node) {
+            continue
+        }
+        basisResources := node.Status.Allocatable
+        if opts.Basis == basisCapacity {
+            basisResources = node.Status.Capacity
+        }
+        nodeCPU := resourceValue(corev1.ResourceCPU, basisResources[corev1.ResourceCPU])
+        nodeRAM := resourceValue(corev1.ResourceMemory, basisResources[corev1.ResourceMemory])
+        report.ClusterCPU += nodeCPU
+        report.ClusterRAM += nodeRAM
+        var price float64
+        if opts.Pricing != nil {
+            price, _ = opts.Pricing.nodePrice(&node)
+            report.ClusterHourlyCost += price
+        }
+
+        // On an overcommitted node, or with --include-terminated, the pods'
+        // shares can add up to more than the node. Scale them down so that
+        // the namespaces never pay more than the node costs.
+        pods := nodePodAllocations(nodePods[node.Name], nil, opts)
+        shares := make([]float64, len(pods))
+        var shareSum float64
+        for i, pod := range pods {
+            shares[i] = allocatedShare(pod.CPURequests, nodeCPU, pod.RAMRequests, nodeRAM)
+            shareSum += shares[i]
+        }
+        scale := 1.0
+        if shareSum > 1 {
+            scale = 1 / shareSum
+        }
+
+        for i, pod := range pods {
+            alloc := get(pod.Namespace)
+            alloc.HourlyCost += price * shares[i] * scale
+            alloc.PodCount++
+            alloc.CPURequests += pod.CPURequests
+            alloc.CPULimits += pod.CPULimits
+            alloc.RAMRequests += pod.RAMRequests
+            alloc.RAMLimits += pod.RAMLimits
+        }
+    }
+
+    // A namespace with several quotas is held to the lowest hard limit of
+    // each resource, so report that one along with its usage.
+    for _, quota := range quotas {
+        for name, hard := range quota.Status.Hard {
+            key, ok := quotaKeys[name]
+            if !ok {
+                continue
+            }
+            alloc := get(quota.Namespace)
+            if alloc.Quota == nil {
+                alloc.Quota = make(map[string]QuotaAllocation)
+            }
+            unit := corev1.ResourceCPU
+            if key == string(corev1.ResourceRequestsMemory) || key == string(corev1.ResourceLimitsMemory) {
+                unit = corev1.ResourceMemory
+            }
+            value := QuotaAllocation{
+                Hard: resourceValue(unit, hard),
+                Used: resourceValue(unit, quota.Status.Used[name]),
+            }
+            if current, ok := alloc.Quota[key]; !ok || value.Hard < current.Hard {
+                alloc.Quota[key] = value
+            }
+        }
+    }
+
+    report.Total = NamespaceAllocation{Namespace: "TOTAL"}
+    for _, alloc := range namespaces {
+        finishNamespace(alloc, report.ClusterCPU, report.ClusterRAM)
+        report.Namespaces = append(report.Namespaces, *alloc)
+
+        report.Total.PodCount += alloc.PodCount
+        report.Total.CPURequests += alloc.CPURequests
+        report.Total.CPULimits += alloc.CPULimits
+        report.Total.RAMRequests += alloc.RAMRequests
+        report.Total.RAMLimits += alloc.RAMLimits
+        report.Total.HourlyCost += alloc.HourlyCost
+        for key, quota := range alloc.Quota {
+            if report.Total.Quota == nil {
+                report.Total.Quota = make(map[string]QuotaAllocation)
+            }
+            total := report.Total.Quota[key]
+            total.Hard += quota.Hard
+            total.Used += quota.Used
+            report.Total.Quota[key] = total
+        }
+    }
+    finishNamespace(&report.Total, report.ClusterCPU, report.ClusterRAM)
+    report.IdleHourlyCost = report.ClusterHourlyCost - report.Total.HourlyCost
+
+    sort.SliceStable(report.Namespaces, func(i, j int) bool {
+        a, b := report.Namespaces[i], report.Namespaces[j]
+        if a.CPURequests != b.CPURequests {
+            return a.CPURequests > b.CPURequests
+        }
+        return a.Namespace < b.Namespace
+    })
+    if opts.Top > 0 && len(report.Namespaces) > opts.Top {
+        report.Namespaces = report.Namespaces[:opts.Top]
+    }
+    return report
+}
+
+// finishNamespace computes the shares of the cluster and flags quotas whose
+// requests the cluster could not satisfy even if it were empty. Limit
+// quotas above the cluster's size are ordinary overcommit and not flagged.
+func finishNamespace(alloc *NamespaceAllocation, clusterCPU, clusterRAM float64) {
+    alloc.CPUSharePct = 100 * ratio(alloc.CPURequests, clusterCPU)
+    alloc.RAMSharePct = 100 * ratio(alloc.RAMRequests, clusterRAM)
+    if quota, ok := alloc.Quota[string(corev1.ResourceRequestsCPU)]; ok && quota.Hard > clusterCPU {
+        alloc.QuotaExceedsCluster = true
+    }
+    if quota, ok := alloc.Quota[string(corev1.ResourceRequestsMemory)]; ok && quota.Hard > clusterRAM {
+        alloc.QuotaExceedsCluster = true
+    }
+}
+
+// writeNamespaceTable writes the --by namespace table, ending with the
+// cluster-wide total. Quota cells are - for namespaces without a quota on
+// the resource. With showCost an HOURLY COST column is added and the idle
+// spend follows the table.
+func writeNamespaceTable(out io.Writer, report NamespaceReport, noHeaders, showCost bool) {
+    w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+    if !noHeaders {
+        fmt.Fprint(w, "NAMESPACE\tPODS\tCPU REQUESTS (Cores)\tCPU LIMITS (Cores)\tCPU SHARE (%)\tCPU QUOTA (Cores)\tCPU QUOTA USED (Cores)\tRAM REQUESTS (GB)\tRAM LIMITS (GB)\tRAM SHARE (%)\tRAM QUOTA (GB)\tRAM QUOTA USED (GB)\tQUOTA EXCEEDS CLUSTER")
+        if showCost {
+            fmt.Fprint(w, "\tHOURLY COST")
+        }
+        fmt.Fprintln(w)
+    }
+    printRow := func(alloc NamespaceAllocation) {
+        cpuQuota, cpuQuotaUsed := quotaCells(alloc, string(corev1.ResourceRequestsCPU))
+        ramQuota, ramQuotaUsed := quotaCells(alloc, string(corev1.ResourceRequestsMemory))
+        exceeds := "no"
+        if alloc.QuotaExceedsCluster {
+            exceeds = "YES"
+        }
+        fmt.Fprintf(w, "%s\t%d\t%.2f\t%.2f\t%.2f\t%s\t%s\t%.2f\t%.2f\t%.2f\t%s\t%s\t%s",
+            alloc.Namespace, alloc.PodCount,
+            alloc.CPURequests, alloc.CPULimits, alloc.CPUSharePct, cpuQuota, cpuQuotaUsed,
+            alloc.RAMRequests, alloc.RAMLimits, alloc.RAMSharePct, ramQuota, ramQuotaUsed,
+            exceeds)
+        if showCost {
+            fmt.Fprintf(w, "\t%.2f", alloc.HourlyCost)
+        }
+        fmt.Fprintln(w)
+    }
+    for _, alloc := range report.Namespaces {
+        printRow(alloc)
+    }
+    printRow(report.Total)
+    w.Flush()
+
+    if showCost {
+        fmt.Fprintf(out, "\nNodes cost %.2f per hour, of which %.2f is idle spend on unrequested capacity\n", report.ClusterHourlyCost, report.IdleHourlyCost)
+    }
+}
+
+func quotaCells(alloc NamespaceAllocation, key string) (string, string) {
+    quota, ok := alloc.Quota[key]
+    if !ok {
+        return "-", "-"
+    }
+    return fmt.Sprintf("%.2f", quota.Hard), fmt.Sprintf("%.2f", quota.Used)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+    "strings"
+
+    corev1 "k8s.io/api/core/v1"
+)
+
+// pressureConditions are the node conditions that make the kubelet reject
+// or evict pods while they are true.
+var pressureConditions = []corev1.NodeConditionType{
+    corev1.NodeMemoryPressure,
+    corev1.NodeDiskPressure,
+    corev1.NodePIDPressure,
+}
+
+// nodeStatus returns the status of a node the way kubectl get nodes shows
+// it, e.g. Ready,SchedulingDisabled, followed by any pressure condition
+// that is true.
+func nodeStatus(node *corev1.Node) string {
+    status := "Unknown"
+    for _, condition := range node.Status.Conditions {
+        if condition.Type != corev1.NodeReady {
+            continue
+        }
+        switch condition.Status {
+        case corev1.ConditionTrue:
+            status = "Ready"
+        case corev1.ConditionFalse:
+            status = "NotReady"
+        }
+    }
+    parts := []string{status}
+    if node.Spec.Unschedulable {
+        parts = append(parts, "SchedulingDisabled")
+    }
+    for _, condition := range node.Status.Conditions {
+        for _, pressure := range pressureConditions {
+            if condition.Type == pressure && condition.Status == corev1.ConditionTrue {
+                parts = append(parts, string(pressure))
+            }
+        }
+    }
+    return strings.Join(parts, ",")
+}
+
+// nodeTaints returns the taints of a node as key=value:Effect.
+func nodeTaints(node *corev1.Node) []string {
+    var taints []string
+    for i := range node.Spec.Taints {
+        taints = append(taints, node.Spec.Taints[i].ToString())
+    }
+    return taints
+}
+
+// nodeHealthy reports whether a node is Ready and under no pressure, so
+// that the kubelet accepts new pods.
+func nodeHealthy(node *corev1.Node) bool {
+    ready := false
+    for _, condition := range node.Status.Conditions {
+        if condition.Type == corev1.NodeReady {
+            ready = condition.Status == corev1.ConditionTrue
+        }
+        for _, pressure := range pressureConditions {
+            if condition.Type == pressure && condition.Status == corev1.ConditionTrue {
+                return false
+            }
+        }
+    }
+    return ready
+}
+
+// nodeSchedulable reports whether new pods can be scheduled on a node
+// without special tolerations: it is healthy, not cordoned and has no
+// NoSchedule or NoExecute taints.
+func nodeSchedulable(node *corev1.Node) bool {
+    if node.Spec.Unschedulable || !nodeHealthy(node) {
+        return false
+    }
+    for _, taint := range node.Spec.Taints {
+        if taint.Effect == corev1.TaintEffectNoSchedule || taint.Effect == corev1.TaintEffectNoExecute {
+            return false
+        }
+    }
+    return true
+}
+
+// statusColumns are the node status columns of the node table. They are
+// text, so they can be sorted by but have no threshold flags.
+var statusColumns = []tableColumn{
+    textColumn("status", "STATUS", func(a NodeAllocation) string { return a.Status }),
+    textColumn("taints", "TAINTS", func(a NodeAllocation) string {
+        if len(a.Taints) == 0 {
+            return "<none>"
+        }
+        return strings.Join(a.Taints, ",")
+    }),
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+)
+
+func TestNodeStatus(t *testing.T) {
+    condition := func(conditionType corev1.NodeConditionType, status corev1.ConditionStatus) func(*corev1.Node) {
+        return func(node *corev1.Node) {
+            for i := range node.Status.Conditions {
+                if node.Status.Conditions[i].Type == conditionType {
+                    node.Status.Conditions[i].Status = status
+                    return
+                }
+            }
+            node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{Type: conditionType, Status: status})
+        }
+    }
+    taint := func(key string, effect corev1.TaintEffect) func(*corev1.Node) {
+        return func(node *corev1.Node) {
+            node.Spec.Taints = append(node.Spec.Taints, corev1.Taint{Key: key, Value: "true", Effect: effect})
+        }
+    }
+    cordon := func(node *corev1.Node) { node.Spec.Unschedulable = true }
+    noConditions := func(node *corev1.Node) { node.Status.Conditions = nil }
+
+    tests := []struct {
+        name            string
+        changes         []func(*corev1.Node)
+        wantStatus      string
+        wantSchedulable bool
+        wantTaints      []string
+    }{
+        {"ready", nil, "Ready", true, nil},
+        {"cordoned", []func(*corev1.Node){cordon}, "Ready,SchedulingDisabled", false, nil},
+        {"not ready", []func(*corev1.Node){condition(corev1.NodeReady, corev1.ConditionFalse)}, "NotReady", false, nil},
+        {"ready unknown", []func(*corev1.Node){condition(corev1.NodeReady, corev1.ConditionUnknown)}, "Unknown", false, nil},
+        {"no ready condition", []func(*corev1.Node){noConditions}, "Unknown", false, nil},
+        {"not ready and cordoned", []func(*corev1.Node){condition(corev1.NodeReady, corev1.ConditionFalse), cordon}, "NotReady,SchedulingDisabled", false, nil},
+        {"memory pressure", []func(*corev1.Node){condition(corev1.NodeMemoryPressure, corev1.ConditionTrue)}, "Ready,MemoryPressure", false, nil},
+        {"disk pressure", []func(*corev1.Node){condition(corev1.NodeDiskPressure, corev1.ConditionTrue)}, "Ready,DiskPressure", false, nil},
+        {"PID pressure", []func(*corev1.Node){condition(corev1.NodePIDPressure, corev1.ConditionTrue)}, "Ready,PIDPressure", false, nil},
+        {"pressure cleared", []func(*corev1.Node){condition(corev1.NodeMemoryPressure, corev1.ConditionFalse)}, "Ready", true, nil},
+        {"NoSchedule taint", []func(*corev1.Node){taint("dedicated", corev1.TaintEffectNoSchedule)}, "Ready", false, []string{"dedicated=true:NoSchedule"}},
+        {"NoExecute taint", []func(*corev1.Node){taint("draining", corev1.TaintEffectNoExecute)}, "Ready", false, []string{"draining=true:NoExecute"}},
+        {"PreferNoSchedule taint", []func(*corev1.Node){taint("spot", corev1.TaintEffectPreferNoSchedule)}, "Ready", true, []string{"spot=true:PreferNoSchedule"}},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            node := testNode("node-a", "4", "8Gi", 110)
+            for _, change := range test.changes {
+                change(&node)
+            }
+            if got := nodeStatus(&node); got != test.wantStatus {
+                t.Errorf("nodeStatus: got %q, want %q", got, test.wantStatus)
+            }
+            if got := nodeSchedulable(&node); got != test.wantSchedulable {
+                t.Errorf("nodeSchedulable: got %v, want %v", got, test.wantSchedulable)
+            }
+            if got := nodeTaints(&node); !reflect.DeepEqual(got, test.wantTaints) {
+                t.Errorf("nodeTaints: got %v, want %v", got, test.wantTaints)
+            }
+        })
+    }
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "strings"
+
+    corev1 "k8s.io/api/core/v1"
+    policyv1 "k8s.io/api/policy/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+    "k8s.io/apimachinery/pkg/runtime"
+    utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// fileSource serves the cluster state from dumped manifests, e.g. the output
+// of `kubectl get nodes,pods,resourcequotas,pdb -A -o json` or the resources
+// of a must-gather or support bundle.
+type fileSource struct {
+    nodes  []corev1.Node
+    pods   []corev1.Pod
+    quotas []corev1.ResourceQuota
+    pdbs   []policyv1.PodDisruptionBudget
+    // seen holds the kind, namespace and name of every object read, so
+    // that objects found in more than one file are only counted once.
+    seen map[string]bool
+}
+
+// newFileSource reads the Nodes, Pods, ResourceQuotas and
+// PodDisruptionBudgets in the given paths.
+// A path may be a JSON or YAML file holding any mix of single objects and
+// lists, or a directory, which is searched recursively for .json, .yaml and
+// .yml files. Files in a directory that cannot be parsed are skipped with a
+// warning, since bundles usually contain more than manifests.
+func newFileSource(warnings io.Writer, paths ...string) (*fileSource, error) {
+    source := &fileSource{seen: make(map[string]bool)}
+    for _, path := range paths {
+        if path == "" {
+            continue
+        }
+
+        info, err := os.Stat(path)
+        if err != nil {
+            return nil, err
+        }
+        if !info.IsDir() {
+            if err := source.readFile(path); err != nil {
+                return nil, fmt.Errorf("%s: %w", path, err)
+            }
+            continue
+        }
+        err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+            if err != nil {
+                return err
+            }
+            switch strings.ToLower(filepath.Ext(file)) {
+            case ".json", ".yaml", ".yml":
+                if entry.IsDir() {
+                    break
+                }
+                if err := source.readFile(file); err != nil {
+                    fmt.Fprintf(warnings, "Warning: skipping %s: %s\n", file, err.Error())
+                }
+            }
+            return nil
+        })
+        if err != nil {
+            return nil, err
+        }
+    }
+    return source, nil
+}
+
+// readFile adds the objects in every document of a file to the source.
+func (s *fileSource) readFile(path string) error {
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+    for {
+        var raw runtime.RawExtension
+        if err := decoder.Decode(&raw); err != nil {
+            if errors.Is(err, io.EOF) {
+                return nil
+            }
+            return err
+        }
+        if len(raw.Raw) == 0 {
+            continue
+        }
+        if err := s.addObject(raw.Raw, ""); err != nil {
+            return err
+        }
+    }
+}
+
+// addObject adds a single JSON object to the source, descending into lists.
+// Items of typed lists such as a NodeList returned by the API server carry
+// no kind of their own, so defaultKind is used for them.
+func (s *fileSource) addObject(data []byte, defaultKind string) error {
+    var typeMeta metav1.TypeMeta
+    if err := json.Unmarshal(data, &typeMeta); err != nil {
+        return err
+    }
+    kind := typeMeta.Kind
+    if kind == "" {
+        kind = defaultKind
+    }
+
+    switch kind {
+    case "Node", "Pod", "ResourceQuota", "PodDisruptionBudget":
+        var meta struct {
+            Metadata metav1.ObjectMeta `json:"metadata"`
+        }
+        if err := json.Unmarshal(data, &meta); err != nil {
+            return err
+        }
+        key := kind + "/" + meta.Metadata.Namespace + "/" + meta.Metadata.Name
+        if s.seen[key] {
+            return nil
+        }
+        s.seen[key] = true
+    }
+
+    switch kind {
+    case "Node":
+        var node corev1.Node
+        if err := json.Unmarshal(data, &node); err != nil {
+            return err
+        }
+        s.nodes = append(s.nodes, node)
+    case "Pod":
+        var pod corev1.Pod
+        if err := json.Unmarshal(data, &pod); err != nil {
+            return err
+        }
+        s.pods = append(s.pods, pod)
+    case "ResourceQuota":
+        var quota corev1.ResourceQuota
+        if err := json.Unmarshal(data, &quota); err != nil {
+            return err
+        }
+        s.quotas = append(s.quotas, quota)
+    case "PodDisruptionBudget":
+        var pdb policyv1.PodDisruptionBudget
+        if err := json.Unmarshal(data, &pdb); err != nil {
+            return err
+        }
+        s.pdbs = append(s.pdbs, pdb)
+    default:
+        if !strings.HasSuffix(kind, "List") {
+            return nil
+        }
+        var list struct {
+            Items []json.RawMessage `json:"items"`
+        }
+        if err := json.Unmarshal(data, &list); err != nil {
+            return err
+        }
+        for _, item := range list.Items {
+            if err := s.addObject(item, strings.TrimSuffix(kind, "List")); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func (s *fileSource) Nodes(selector string) ([]corev1.Node, error) {
+    parsed, err := labels.Parse(selector)
+    if err != nil {
+        return nil, err
+    }
+    var nodes []corev1.Node
+    for _, node := range s.nodes {
+        if parsed.Matches(labels.Set(node.Labels)) {
+            nodes = append(nodes, node)
+        }
+    }
+    return nodes, nil
+}
+
+func (s *fileSource) Node(name string) (*corev1.Node, error) {
+    for i := range s.nodes {
+        if s.nodes[i].Name == name {
+            return &s.nodes[i], nil
+        }
+    }
+    return nil, fmt.Errorf("node %q not found in the given files", name)
+}
+
+func (s *fileSource) Pods() ([]corev1.Pod, error) {
+    var pods []corev1.Pod
+    for _, pod := range s.pods {
+        if pod.Spec.NodeName != "" {
+            pods = append(pods, pod)
+        }
+    }
+    return pods, nil
+}
+
+func (s *fileSource) NodePods(nodeName string) ([]corev1.Pod, error) {
+    var pods []corev1.Pod
+    for _, pod := range s.pods {
+        if pod.Spec.NodeName == nodeName {
+            pods = append(pods, pod)
+        }
+    }
+    return pods, nil
+}
+
+func (s *fileSource) PendingPods() ([]corev1.Pod, error) {
+    var pods []corev1.Pod
+    for _, pod := range s.pods {
+        if pod.Spec.NodeName == "" && pod.Status.Phase == corev1.PodPending {
+            pods = append(pods, pod)
+        }
+    }
+    return pods, nil
+}
+
+func (s *fileSource) ResourceQuotas() ([]corev1.ResourceQuota, error) {
+    return s.quotas, nil
+}
+
+func (s *fileSource) PodDisruptionBudgets() ([]policyv1.PodDisruptionBudget, error) {
+    return s.pdbs, nil
+}
+
+func (s *fileSource) Usage(pods []corev1.Pod) (map[string]nodeUsage, error) {
+    return nil, fmt.Errorf("usage is not available when reading from files")
+}
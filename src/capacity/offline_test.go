@@ -0,0 +1,168 @@
+package main
+
+import (
+    "bytes"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+)
+
+const nodeManifest = `apiVersion: v1
+kind: Node
+metadata:
+  name: node-a
+  labels:
+    pool: general
+status:
+  allocatable:
+    cpu: "4"
+    memory: 8Gi
+    pods: "110"
+`
+
+const podListManifest = `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {"apiVersion": "v1", "kind": "Pod", "metadata": {"namespace": "default", "name": "web"}, "spec": {"nodeName": "node-a"}},
+    {"apiVersion": "v1", "kind": "Pod", "metadata": {"namespace": "default", "name": "queued"}, "status": {"phase": "Pending"}},
+    {"apiVersion": "v1", "kind": "Service", "metadata": {"namespace": "default", "name": "web"}}
+  ]
+}
+`
+
+// nodeListManifest is a typed list as returned by the API server, whose
+// items carry no kind.
+const nodeListManifest = `{
+  "apiVersion": "v1",
+  "kind": "NodeList",
+  "items": [
+    {"metadata": {"name": "node-a"}},
+    {"metadata": {"name": "node-b"}}
+  ]
+}
+`
+
+// writeFile writes content to name under dir, creating parent directories.
+func writeFile(t *testing.T, dir, name, content string) string {
+    t.Helper()
+    path := filepath.Join(dir, name)
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestFileSourceSingleObject(t *testing.T) {
+    path := writeFile(t, t.TempDir(), "node.yaml", nodeManifest)
+    source, err := newFileSource(&bytes.Buffer{}, path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    nodes, err := source.Nodes("pool=general")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(nodes) != 1 || nodes[0].Name != "node-a" {
+        t.Fatalf("got %d nodes, want node-a", len(nodes))
+    }
+    cpu := nodes[0].Status.Allocatable["cpu"]
+    if cpu.String() != "4" {
+        t.Errorf("allocatable cpu: got %s, want 4", cpu.String())
+    }
+}
+
+func TestFileSourceList(t *testing.T) {
+    path := writeFile(t, t.TempDir(), "pods.json", podListManifest)
+    source, err := newFileSource(&bytes.Buffer{}, path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(source.pods) != 2 {
+        t.Fatalf("got %d pods, want 2", len(source.pods))
+    }
+    bound, _ := source.Pods()
+    if len(bound) != 1 || bound[0].Name != "web" {
+        t.Errorf("bound pods: got %v, want [web]", podNames(bound))
+    }
+    pending, _ := source.PendingPods()
+    if len(pending) != 1 || pending[0].Name != "queued" {
+        t.Errorf("pending pods: got %v, want [queued]", podNames(pending))
+    }
+}
+
+func TestFileSourceTypedList(t *testing.T) {
+    path := writeFile(t, t.TempDir(), "nodes.json", nodeListManifest)
+    source, err := newFileSource(&bytes.Buffer{}, path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(source.nodes) != 2 {
+        t.Fatalf("got %d nodes, want the 2 items of the NodeList", len(source.nodes))
+    }
+    if _, err := source.Node("node-b"); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestFileSourceDeduplicates(t *testing.T) {
+    dir := t.TempDir()
+    single := writeFile(t, dir, "node.yaml", nodeManifest)
+    list := writeFile(t, dir, "nodes.json", nodeListManifest)
+    source, err := newFileSource(&bytes.Buffer{}, single, list, single)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(source.nodes) != 2 {
+        t.Fatalf("got %d nodes, want node-a only once and node-b", len(source.nodes))
+    }
+    // The first copy read wins
+    if source.nodes[0].Labels["pool"] != "general" {
+        t.Errorf("node-a: got labels %v, want the ones of node.yaml", source.nodes[0].Labels)
+    }
+}
+
+func TestFileSourceDirectory(t *testing.T) {
+    dir := t.TempDir()
+    writeFile(t, dir, "cluster/nodes/node.yaml", nodeManifest)
+    writeFile(t, dir, "cluster/pods.json", podListManifest)
+    writeFile(t, dir, "cluster/notes.txt", "not a manifest")
+    writeFile(t, dir, "cluster/broken.yaml", "kind: [")
+
+    var warnings bytes.Buffer
+    source, err := newFileSource(&warnings, dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(source.nodes) != 1 || len(source.pods) != 2 {
+        t.Errorf("got %d nodes and %d pods, want 1 and 2", len(source.nodes), len(source.pods))
+    }
+    if !strings.Contains(warnings.String(), "broken.yaml") {
+        t.Errorf("got warnings %q, want one for broken.yaml", warnings.String())
+    }
+    if strings.Contains(warnings.String(), "notes.txt") {
+        t.Errorf("got warnings %q, want files without a manifest extension ignored", warnings.String())
+    }
+}
+
+func TestFileSourceBrokenFile(t *testing.T) {
+    path := writeFile(t, t.TempDir(), "broken.yaml", "kind: [")
+    if _, err := newFileSource(&bytes.Buffer{}, path); err == nil {
+        t.Error("got no error for a file given directly that cannot be parsed")
+    }
+}
+
+// podNames returns the names of the given pods.
+func podNames(pods []corev1.Pod) []string {
+    var names []string
+    for _, pod := range pods {
+        names = append(names, pod.Name)
+    }
+    return names
+}
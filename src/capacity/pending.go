@@ -0,0 +1,318 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "math"
+    "os"
+    "sort"
+    "strings"
+    "text/tabwriter"
+
+    corev1 "k8s.io/api/core/v1"
+)
+
+// Values of PendingReport.Verdict.
+const (
+    verdictFragmentation = "fragmentation"
+    verdictCapacity      = "capacity"
+)
+
+// PendingPod is a pod the scheduler could not place, with the node that
+// comes closest to taking it. Shortfall is what that node lacks per
+// resource, in cores, GB or a plain count, and is empty if the pod fits
+// there on requests alone.
+type PendingPod struct {
+    Namespace   string             `json:"namespace" yaml:"namespace"`
+    Name        string             `json:"name" yaml:"name"`
+    OwnerKind   string             `json:"owner_kind,omitempty" yaml:"owner_kind,omitempty"`
+    OwnerName   string             `json:"owner_name,omitempty" yaml:"owner_name,omitempty"`
+    CPURequests float64            `json:"cpu_requests" yaml:"cpu_requests"`
+    RAMRequests float64            `json:"ram_requests" yaml:"ram_requests"`
+    Message     string             `json:"message,omitempty" yaml:"message,omitempty"`
+    ClosestNode string             `json:"closest_node,omitempty" yaml:"closest_node,omitempty"`
+    Shortfall   map[string]float64 `json:"shortfall,omitempty" yaml:"shortfall,omitempty"`
+    Diagnosis   string             `json:"diagnosis" yaml:"diagnosis"`
+}
+
+// PendingReport is the output of the pending command. The free figures
+// are summed over the nodes that accept at least one of the pending pods,
+// see nodeAccepts. Verdict is capacity if the pending demand exceeds them
+// and fragmentation if it does not, and empty when nothing is pending.
+type PendingReport struct {
+    Pods         []PendingPod `json:"pods" yaml:"pods"`
+    PendingCPU   float64      `json:"pending_cpu" yaml:"pending_cpu"`
+    PendingRAM   float64      `json:"pending_ram" yaml:"pending_ram"`
+    FreeCPU      float64      `json:"free_cpu" yaml:"free_cpu"`
+    FreeRAM      float64      `json:"free_ram" yaml:"free_ram"`
+    FreePodSlots int64        `json:"free_pod_slots" yaml:"free_pod_slots"`
+    Verdict      string       `json:"verdict,omitempty" yaml:"verdict,omitempty"`
+}
+
+func runPending(args []string) {
+    fs := flag.NewFlagSet("pending", flag.ExitOnError)
+    kubeconfig := fs.String("kubeconfig", "", "absolute path to the kubeconfig file")
+    contextName := fs.String("context", "", "name of the kubeconfig context to use")
+    outputFormat := fs.String("output", "table", "output format: table, json, yaml (use -o for short form)")
+    noHeaders := fs.Bool("no-headers", false, "if true, omit header row in output")
+    selector := fs.String("selector", "", "label selector to filter nodes")
+    namespace := fs.String("namespace", "", "if set, only list Pending pods in this namespace")
+    basis := fs.String("basis", basisAllocatable, "node resources free capacity is computed from: allocatable, capacity")
+    nodesFile := fs.String("nodes-file", "", "read nodes from this JSON/YAML file or directory instead of the API server")
+    podsFile := fs.String("pods-file", "", "read pods from this JSON/YAML file or directory instead of the API server")
+
+    // Short flags
+    outputFlag := fs.String("o", "table", "output format: table, json, yaml")
+    selectorFlag := fs.String("l", "", "label selector to filter nodes")
+    namespaceFlag := fs.String("n", "", "if set, only list Pending pods in this namespace")
+
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kubectl pod-capacity pending [flags]\n\n")
+        fmt.Fprintf(os.Stderr, "This command lists the pods the scheduler marked Unschedulable with the node that comes closest to taking each, and compares the pending demand with the free capacity\n\n")
+        fmt.Fprintf(os.Stderr, "Flags:\n")
+        fmt.Fprintf(os.Stderr, "  -n, --namespace string   if set, only list Pending pods in this namespace\n")
+        fmt.Fprintf(os.Stderr, "  -o, --output string      output format: table, json, yaml\n")
+        fmt.Fprintf(os.Stderr, "  --kubeconfig string      absolute path to the kubeconfig file\n")
+        fmt.Fprintf(os.Stderr, "  --context string         name of the kubeconfig context to use\n")
+        fmt.Fprintf(os.Stderr, "  --no-headers             if true, omit header row in output\n")
+        fmt.Fprintf(os.Stderr, "  -l, --selector string    label selector to filter nodes\n")
+        fmt.Fprintf(os.Stderr, "  --basis string           node resources free capacity is computed from: allocatable, capacity (default allocatable)\n")
+        fmt.Fprintf(os.Stderr, "  --nodes-file string      read nodes from this JSON/YAML file or directory instead of the API server\n")
+        fmt.Fprintf(os.Stderr, "  --pods-file string       read pods from this JSON/YAML file or directory instead of the API server\n")
+    }
+
+    fs.Parse(args)
+
+    if *outputFlag != "table" {
+        *outputFormat = *outputFlag
+    }
+    if *selectorFlag != "" {
+        *selector = *selectorFlag
+    }
+    if *namespaceFlag != "" {
+        *namespace = *namespaceFlag
+    }
+    if *basis != basisAllocatable && *basis != basisCapacity {
+        fmt.Println("Invalid basis. Supported values: allocatable, capacity.")
+        os.Exit(1)
+    }
+
+    source := openSource(*kubeconfig, *contextName, *nodesFile, *podsFile)
+    nodes, err := source.Nodes(*selector)
+    if err != nil {
+        fmt.Printf("Error fetching nodes: %s\n", err.Error())
+        os.Exit(1)
+    }
+    pods, err := source.Pods()
+    if err != nil {
+        fmt.Printf("Error fetching pods: %s\n", err.Error())
+        os.Exit(1)
+    }
+    pendingPods, err := source.PendingPods()
+    if err != nil {
+        fmt.Printf("Error fetching pending pods: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    var unschedulable []corev1.Pod
+    for _, pod := range pendingPods {
+        if (*namespace == "" || pod.Namespace == *namespace) && unschedulableCondition(&pod) != nil {
+            unschedulable = append(unschedulable, pod)
+        }
+    }
+    report := pendingDemand(unschedulable, newNodeStates(nodes, podsByNode(pods), *basis))
+
+    switch *outputFormat {
+    case "json":
+        outputJSON(report)
+    case "yaml":
+        outputYAML(report)
+    case "table":
+        writePendingTable(os.Stdout, report, *noHeaders)
+    default:
+        fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
+        os.Exit(1)
+    }
+}
+
+// unschedulableCondition returns the PodScheduled condition of a pod if the
+// scheduler has marked it Unschedulable, and nil otherwise.
+func unschedulableCondition(pod *corev1.Pod) *corev1.PodCondition {
+    for i := range pod.Status.Conditions {
+        condition := &pod.Status.Conditions[i]
+        if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && condition.Reason == corev1.PodReasonUnschedulable {
+            return condition
+        }
+    }
+    return nil
+}
+
+// pendingDemand finds the closest node for every pending pod and sums the
+// pending demand and the free capacity of the nodes any of the pods could
+// use, the same nodes the closest node is picked from. Pods are ordered by
+// namespace and name.
+func pendingDemand(pods []corev1.Pod, states []*nodeState) PendingReport {
+    var report PendingReport
+    for _, state := range states {
+        accepted := false
+        for i := range pods {
+            if nodeAccepts(&pods[i], state.Node) {
+                accepted = true
+                break
+            }
+        }
+        if !accepted {
+            continue
+        }
+        report.FreeCPU += math.Max(resourceValue(corev1.ResourceCPU, state.Free[corev1.ResourceCPU]), 0)
+        report.FreeRAM += math.Max(resourceValue(corev1.ResourceMemory, state.Free[corev1.ResourceMemory]), 0)
+        slots := state.Free[corev1.ResourcePods]
+        report.FreePodSlots += max(slots.Value(), 0)
+    }
+
+    for i := range pods {
+        pending := newPendingPod(&pods[i], states)
+        report.PendingCPU += pending.CPURequests
+        report.PendingRAM += pending.RAMRequests
+        report.Pods = append(report.Pods, pending)
+    }
+    sort.SliceStable(report.Pods, func(i, j int) bool {
+        a, b := report.Pods[i], report.Pods[j]
+        if a.Namespace != b.Namespace {
+            return a.Namespace < b.Namespace
+        }
+        return a.Name < b.Name
+    })
+
+    if len(report.Pods) > 0 {
+        report.Verdict = verdictFragmentation
+        if report.PendingCPU > report.FreeCPU || report.PendingRAM > report.FreeRAM || int64(len(report.Pods)) > report.FreePodSlots {
+            report.Verdict = verdictCapacity
+        }
+    }
+    return report
+}
+
+// nodeAccepts reports whether a pod could be scheduled on a node given
+// enough free resources: the node is healthy, see nodeHealthy, and the
+// pod's node selector, affinity and tolerations allow it.
+func nodeAccepts(pod *corev1.Pod, node *corev1.Node) bool {
+    return nodeHealthy(node) && checkConstraints(pod, node) == ""
+}
+
+// newPendingPod picks the node that comes closest to taking a pod: of the
+// nodes that accept it, the one with the smallest shortfall, each resource
+// counted as a fraction of what the pod requests.
+func newPendingPod(pod *corev1.Pod, states []*nodeState) PendingPod {
+    requests := placementRequests(pod)
+    cpuRequests := requests[corev1.ResourceCPU]
+    ramRequests := requests[corev1.ResourceMemory]
+    pending := PendingPod{
+        Namespace:   pod.Namespace,
+        Name:        pod.Name,
+        CPURequests: resourceValue(corev1.ResourceCPU, cpuRequests),
+        RAMRequests: resourceValue(corev1.ResourceMemory, ramRequests),
+    }
+    pending.OwnerKind, pending.OwnerName = podWorkload(pod)
+    if condition := unschedulableCondition(pod); condition != nil {
+        pending.Message = condition.Message
+    }
+
+    var closest corev1.ResourceList
+    closestScore := math.Inf(1)
+    for _, state := range states {
+        if !nodeAccepts(pod, state.Node) {
+            continue
+        }
+        short := resourceShortfall(state.Free, requests)
+        var score float64
+        for name, quantity := range short {
+            request := requests[name]
+            score += ratio(float64(quantity.MilliValue()), float64(request.MilliValue()))
+        }
+        if score < closestScore {
+            closest, closestScore = short, score
+            pending.ClosestNode = state.Node.Name
+        }
+    }
+
+    switch {
+    case pending.ClosestNode == "":
+        pending.Diagnosis = "no healthy node matches its node selector, affinity or tolerations"
+    case len(closest) == 0:
+        pending.Diagnosis = fmt.Sprintf("fits on %s by requests; blocked by something capacity does not check, e.g. pod affinity, host ports or volumes", pending.ClosestNode)
+    default:
+        pending.Shortfall = make(map[string]float64, len(closest))
+        names := make([]string, 0, len(closest))
+        for name := range closest {
+            names = append(names, string(name))
+        }
+        sort.Strings(names)
+        var parts []string
+        for _, name := range names {
+            value := resourceValue(corev1.ResourceName(name), closest[corev1.ResourceName(name)])
+            pending.Shortfall[name] = value
+            parts = append(parts, shortfallText(corev1.ResourceName(name), value))
+        }
+        pending.Diagnosis = fmt.Sprintf("needs %s on %s", strings.Join(parts, ", "), pending.ClosestNode)
+    }
+    return pending
+}
+
+// resourceShortfall returns how much of each requested resource free lacks.
+// Resources free has enough of are left out. On an overcommitted node free
+// is negative, and the node lacks the request plus the overcommit.
+func resourceShortfall(free, requests corev1.ResourceList) corev1.ResourceList {
+    short := make(corev1.ResourceList)
+    for name, request := range requests {
+        available := free[name]
+        if available.Cmp(request) >= 0 {
+            continue
+        }
+        missing := request.DeepCopy()
+        missing.Sub(available)
+        short[name] = missing
+    }
+    return short
+}
+
+// shortfallText phrases a shortfall for the table, e.g. "1.20 more cores".
+func shortfallText(name corev1.ResourceName, value float64) string {
+    switch {
+    case name == corev1.ResourcePods:
+        return fmt.Sprintf("%.0f more pod slots", value)
+    case name == corev1.ResourceCPU:
+        return fmt.Sprintf("%.2f more cores", value)
+    case name == corev1.ResourceMemory:
+        return fmt.Sprintf("%.2f more GB", value)
+    case isByteResource(name):
+        return fmt.Sprintf("%.2f more GB of %s", value, name)
+    default:
+        return fmt.Sprintf("%g more %s", value, name)
+    }
+}
+
+func writePendingTable(out io.Writer, report PendingReport, noHeaders bool) {
+    w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+    if !noHeaders {
+        fmt.Fprintln(w, "NAMESPACE\tNAME\tOWNER\tCPU REQUESTS (Cores)\tRAM REQUESTS (GB)\tDIAGNOSIS")
+    }
+    for _, pod := range report.Pods {
+        owner := "<none>"
+        if pod.OwnerKind != "" {
+            owner = pod.OwnerKind + "/" + pod.OwnerName
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%.2f\t%.2f\t%s\n", pod.Namespace, pod.Name, owner, pod.CPURequests, pod.RAMRequests, pod.Diagnosis)
+    }
+    w.Flush()
+
+    fmt.Fprintf(out, "\nPending demand: %.2f cores, %.2f GB, %d pods\n", report.PendingCPU, report.PendingRAM, len(report.Pods))
+    fmt.Fprintf(out, "Free on nodes the pending pods can use: %.2f cores, %.2f GB, %d pod slots\n", report.FreeCPU, report.FreeRAM, report.FreePodSlots)
+    switch report.Verdict {
+    case verdictFragmentation:
+        fmt.Fprintln(out, "The pending pods fit into the total free capacity, but not node by node: a fragmentation problem")
+    case verdictCapacity:
+        fmt.Fprintln(out, "The pending demand exceeds the total free capacity: a capacity problem")
+    }
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// pendingPod returns an unbound pod the scheduler marked Unschedulable.
+func pendingPod(namespace, name, cpu, memory string) corev1.Pod {
+    pod := testPod(namespace, name, "", cpu, memory)
+    pod.Status = corev1.PodStatus{
+        Phase: corev1.PodPending,
+        Conditions: []corev1.PodCondition{{
+            Type:    corev1.PodScheduled,
+            Status:  corev1.ConditionFalse,
+            Reason:  corev1.PodReasonUnschedulable,
+            Message: "0/2 nodes are available: 2 Insufficient cpu.",
+        }},
+    }
+    return pod
+}
+
+func TestPendingDemandFragmentation(t *testing.T) {
+    nodes := []corev1.Node{
+        testNode("node-a", "4", "8Gi", 110),
+        testNode("node-b", "4", "8Gi", 110),
+    }
+    bound := []corev1.Pod{
+        testPod("default", "a", "node-a", "3", "2Gi"),
+        testPod("default", "b", "node-b", "3200m", "2Gi"),
+    }
+    pending := []corev1.Pod{pendingPod("default", "big", "1500m", "1Gi")}
+
+    report := pendingDemand(pending, newNodeStates(nodes, podsByNode(bound), basisAllocatable))
+    if report.Verdict != verdictFragmentation {
+        t.Errorf("got verdict %q, want %q", report.Verdict, verdictFragmentation)
+    }
+    if report.PendingCPU != 1.5 || report.FreeCPU != 1.8 || report.FreeRAM != 12 || report.FreePodSlots != 218 {
+        t.Errorf("got %.2f cores pending, %.2f cores, %.2fGB and %d pod slots free", report.PendingCPU, report.FreeCPU, report.FreeRAM, report.FreePodSlots)
+    }
+    pod := report.Pods[0]
+    if pod.ClosestNode != "node-a" || !reflect.DeepEqual(pod.Shortfall, map[string]float64{"cpu": 0.5}) {
+        t.Errorf("got closest node %s short of %v, want node-a short of 0.5 cores", pod.ClosestNode, pod.Shortfall)
+    }
+    if want := "needs 0.50 more cores on node-a"; pod.Diagnosis != want {
+        t.Errorf("got diagnosis %q, want %q", pod.Diagnosis, want)
+    }
+    if pod.Message != "0/2 nodes are available: 2 Insufficient cpu." {
+        t.Errorf("got message %q", pod.Message)
+    }
+}
+
+func TestPendingDemandCapacity(t *testing.T) {
+    gpu := testNode("gpu", "8", "32Gi", 110)
+    gpu.Labels["accelerator"] = "nvidia"
+    gpu.Spec.Taints = []corev1.Taint{{Key: "nvidia.com/gpu", Effect: corev1.TaintEffectNoSchedule}}
+    notReady := testNode("not-ready", "64", "256Gi", 110)
+    notReady.Labels["accelerator"] = "nvidia"
+    notReady.Status.Conditions[0].Status = corev1.ConditionFalse
+    plain := testNode("plain", "4", "8Gi", 110)
+
+    bound := []corev1.Pod{testPod("ml", "running", "gpu", "7", "16Gi")}
+    training := pendingPod("ml", "training", "4", "8Gi")
+    training.Spec.NodeSelector = map[string]string{"accelerator": "nvidia"}
+    training.Spec.Tolerations = []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists}}
+
+    report := pendingDemand([]corev1.Pod{training}, newNodeStates([]corev1.Node{gpu, notReady, plain}, podsByNode(bound), basisAllocatable))
+
+    // Only the tainted gpu node counts: plain doesn't match the selector
+    // and not-ready can't take pods however big it is
+    if report.FreeCPU != 1 || report.FreeRAM != 16 || report.FreePodSlots != 109 {
+        t.Errorf("got %.2f cores, %.2fGB and %d pod slots free, want only the gpu node's", report.FreeCPU, report.FreeRAM, report.FreePodSlots)
+    }
+    if report.Verdict != verdictCapacity {
+        t.Errorf("got verdict %q, want %q", report.Verdict, verdictCapacity)
+    }
+    pod := report.Pods[0]
+    if pod.ClosestNode != "gpu" || pod.Diagnosis != "needs 3.00 more cores on gpu" {
+        t.Errorf("got closest node %s with diagnosis %q", pod.ClosestNode, pod.Diagnosis)
+    }
+}
+
+func TestPendingDemandWithoutMatchingNode(t *testing.T) {
+    nodes := []corev1.Node{testNode("plain", "4", "8Gi", 110)}
+    pod := pendingPod("default", "picky", "100m", "128Mi")
+    pod.Spec.NodeSelector = map[string]string{"disk": "ssd"}
+
+    report := pendingDemand([]corev1.Pod{pod}, newNodeStates(nodes, nil, basisAllocatable))
+    if got := report.Pods[0]; got.ClosestNode != "" || got.Diagnosis != "no healthy node matches its node selector, affinity or tolerations" {
+        t.Errorf("got closest node %q with diagnosis %q", got.ClosestNode, got.Diagnosis)
+    }
+    if report.FreeCPU != 0 || report.Verdict != verdictCapacity {
+        t.Errorf("got %.2f cores free and verdict %q, want nothing free and %q", report.FreeCPU, report.Verdict, verdictCapacity)
+    }
+}
+
+func TestPendingDemandWithoutPendingPods(t *testing.T) {
+    report := pendingDemand(nil, newNodeStates([]corev1.Node{testNode("plain", "4", "8Gi", 110)}, nil, basisAllocatable))
+    if report.Verdict != "" || len(report.Pods) != 0 {
+        t.Errorf("got verdict %q and %d pods, want neither", report.Verdict, len(report.Pods))
+    }
+}
+
+func TestResourceShortfall(t *testing.T) {
+    free := corev1.ResourceList{
+        corev1.ResourceCPU:    resource.MustParse("-500m"),
+        corev1.ResourceMemory: resource.MustParse("1Gi"),
+        corev1.ResourcePods:   resource.MustParse("0"),
+    }
+    requests := corev1.ResourceList{
+        corev1.ResourceCPU:    resource.MustParse("1"),
+        corev1.ResourceMemory: resource.MustParse("512Mi"),
+        corev1.ResourcePods:   resource.MustParse("1"),
+        "nvidia.com/gpu":      resource.MustParse("2"),
+    }
+    short := resourceShortfall(free, requests)
+    want := map[corev1.ResourceName]string{
+        // The node is 500m overcommitted, so it lacks 1.5 cores
+        corev1.ResourceCPU:  "1500m",
+        corev1.ResourcePods: "1",
+        "nvidia.com/gpu":    "2",
+    }
+    if len(short) != len(want) {
+        t.Errorf("got shortfall %v, want %v", short, want)
+    }
+    for name, value := range want {
+        quantity, ok := short[name]
+        if !ok || quantity.Cmp(resource.MustParse(value)) != 0 {
+            t.Errorf("%s: got %s, want %s", name, quantity.String(), value)
+        }
+    }
+}
+
+func TestShortfallText(t *testing.T) {
+    tests := []struct {
+        name  corev1.ResourceName
+        value float64
+        want  string
+    }{
+        {corev1.ResourcePods, 2, "2 more pod slots"},
+        {corev1.ResourceCPU, 1.5, "1.50 more cores"},
+        {corev1.ResourceMemory, 0.25, "0.25 more GB"},
+        {corev1.ResourceEphemeralStorage, 10, "10.00 more GB of ephemeral-storage"},
+        {"nvidia.com/gpu", 1, "1 more nvidia.com/gpu"},
+    }
+    for _, test := range tests {
+        if got := shortfallText(test.name, test.value); got != test.want {
+            t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+        }
+    }
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "text/tabwriter"
+
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+)
+
+// ContainerAllocation is the CPU and RAM requests and limits of a single
+// container.
+type ContainerAllocation struct {
+    Name       string  `json:"name" yaml:"name"`
+    Init       bool    `json:"init,omitempty" yaml:"init,omitempty"`
+    CPURequest float64 `json:"cpu_request" yaml:"cpu_request"`
+    CPULimit   float64 `json:"cpu_limit" yaml:"cpu_limit"`
+    RAMRequest float64 `json:"ram_request" yaml:"ram_request"`
+    RAMLimit   float64 `json:"ram_limit" yaml:"ram_limit"`
+}
+
+// PodAllocation is what a single pod takes from the node it runs on.
+// OwnerKind and OwnerName are the workload that manages the pod, see
+// podWorkload.
+type PodAllocation struct {
+    Namespace     string                `json:"namespace" yaml:"namespace"`
+    Name          string                `json:"name" yaml:"name"`
+    NodeName      string                `json:"node_name" yaml:"node_name"`
+    OwnerKind     string                `json:"owner_kind,omitempty" yaml:"owner_kind,omitempty"`
+    OwnerName     string                `json:"owner_name,omitempty" yaml:"owner_name,omitempty"`
+    QOSClass      string                `json:"qos_class" yaml:"qos_class"`
+    PriorityClass string                `json:"priority_class,omitempty" yaml:"priority_class,omitempty"`
+    CPURequests   float64               `json:"cpu_requests" yaml:"cpu_requests"`
+    CPULimits     float64               `json:"cpu_limits" yaml:"cpu_limits"`
+    CPUSharePct   float64               `json:"cpu_share_pct" yaml:"cpu_share_pct"`
+    RAMRequests   float64               `json:"ram_requests" yaml:"ram_requests"`
+    RAMLimits     float64               `json:"ram_limits" yaml:"ram_limits"`
+    RAMSharePct   float64               `json:"ram_share_pct" yaml:"ram_share_pct"`
+    Containers    []ContainerAllocation `json:"containers" yaml:"containers"`
+}
+
+// newPodAllocation reports the effective requests and limits of a pod and
+// its requests as a share of the node's allocatable resources (or capacity,
+// depending on basis).
+func newPodAllocation(pod *corev1.Pod, node *corev1.Node, basis string) PodAllocation {
+    requests := podRequests(pod)
+    limits := podLimits(pod)
+    cpuRequests := requests[corev1.ResourceCPU]
+    ramRequests := requests[corev1.ResourceMemory]
+    cpuLimits := limits[corev1.ResourceCPU]
+    ramLimits := limits[corev1.ResourceMemory]
+
+    alloc := PodAllocation{
+        Namespace:     pod.Namespace,
+        Name:          pod.Name,
+        NodeName:      pod.Spec.NodeName,
+        QOSClass:      string(pod.Status.QOSClass),
+        PriorityClass: pod.Spec.PriorityClassName,
+        CPURequests:   float64(cpuRequests.MilliValue()) / 1000.0,
+        CPULimits:     float64(cpuLimits.MilliValue()) / 1000.0,
+        RAMRequests:   float64(ramRequests.Value()) / (1024 * 1024 * 1024),
+        RAMLimits:     float64(ramLimits.Value()) / (1024 * 1024 * 1024),
+    }
+    alloc.OwnerKind, alloc.OwnerName = podWorkload(pod)
+
+    if node != nil {
+        basisResources := node.Status.Allocatable
+        if basis == basisCapacity {
+            basisResources = node.Status.Capacity
+        }
+        cpuBasis := basisResources[corev1.ResourceCPU]
+        ramBasis := basisResources[corev1.ResourceMemory]
+        alloc.CPUSharePct = 100 * ratio(float64(cpuRequests.MilliValue()), float64(cpuBasis.MilliValue()))
+        alloc.RAMSharePct = 100 * ratio(float64(ramRequests.Value()), float64(ramBasis.Value()))
+    }
+
+    for _, container := range pod.Spec.InitContainers {
+        alloc.Containers = append(alloc.Containers, newContainerAllocation(container, true))
+    }
+    for _, container := range pod.Spec.Containers {
+        alloc.Containers = append(alloc.Containers, newContainerAllocation(container, false))
+    }
+    return alloc
+}
+
+func newContainerAllocation(container corev1.Container, init bool) ContainerAllocation {
+    cpuRequest := container.Resources.Requests[corev1.ResourceCPU]
+    cpuLimit := container.Resources.Limits[corev1.ResourceCPU]
+    ramRequest := container.Resources.Requests[corev1.ResourceMemory]
+    ramLimit := container.Resources.Limits[corev1.ResourceMemory]
+    return ContainerAllocation{
+        Name:       container.Name,
+        Init:       init,
+        CPURequest: float64(cpuRequest.MilliValue()) / 1000.0,
+        CPULimit:   float64(cpuLimit.MilliValue()) / 1000.0,
+        RAMRequest: float64(ramRequest.Value()) / (1024 * 1024 * 1024),
+        RAMLimit:   float64(ramLimit.Value()) / (1024 * 1024 * 1024),
+    }
+}
+
+// podWorkload returns the kind and name of the workload that manages a pod:
+// its controller, or the Deployment behind it when the controller is a
+// ReplicaSet created by a Deployment. The Deployment is recognised by the
+// pod-template-hash suffix the deployment controller gives its ReplicaSets,
+// so no extra API calls are needed. Both are empty for bare pods.
+func podWorkload(pod *corev1.Pod) (string, string) {
+    owner := metav1.GetControllerOf(pod)
+    if owner == nil {
+        return "", ""
+    }
+    if owner.Kind == "ReplicaSet" {
+        hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+        if hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+            return "Deployment", strings.TrimSuffix(owner.Name, "-"+hash)
+        }
+    }
+    return owner.Kind, owner.Name
+}
+
+// workloadResolver finds the workload that manages a pod like podWorkload,
+// but looks up the controller of a ReplicaSet through the API instead of
+// guessing it from the pod-template-hash, so that ReplicaSets owned by
+// something other than a Deployment, or named differently, are resolved
+// too. Each ReplicaSet is looked up once.
+type workloadResolver struct {
+    clientset   kubernetes.Interface
+    replicaSets map[string]workloadRef
+}
+
+// workloadRef is the kind and name of a workload.
+type workloadRef struct {
+    Kind, Name string
+}
+
+func newWorkloadResolver(clientset kubernetes.Interface) *workloadResolver {
+    return &workloadResolver{clientset: clientset, replicaSets: make(map[string]workloadRef)}
+}
+
+// workload returns the kind and name of the workload that manages a pod,
+// both empty for bare pods. If a ReplicaSet can't be fetched, e.g. because
+// it is gone or not readable, it falls back to podWorkload.
+func (r *workloadResolver) workload(pod *corev1.Pod) (string, string) {
+    owner := metav1.GetControllerOf(pod)
+    if owner == nil || owner.Kind != "ReplicaSet" {
+        return podWorkload(pod)
+    }
+    key := pod.Namespace + "/" + owner.Name
+    if resolved, ok := r.replicaSets[key]; ok {
+        return resolved.Kind, resolved.Name
+    }
+    kind, name := podWorkload(pod)
+    replicaSet, err := r.clientset.AppsV1().ReplicaSets(pod.Namespace).Get(context.TODO(), owner.Name, metav1.GetOptions{})
+    if err == nil {
+        kind, name = "ReplicaSet", replicaSet.Name
+        if controller := metav1.GetControllerOf(replicaSet); controller != nil {
+            kind, name = controller.Kind, controller.Name
+        }
+    }
+    r.replicaSets[key] = workloadRef{Kind: kind, Name: name}
+    return kind, name
+}
+
+// nodePodAllocations returns the allocation of every pod in pods, leaving
+// out terminated pods unless includeTerminated is set.
+func nodePodAllocations(pods []corev1.Pod, node *corev1.Node, opts reportOptions) []PodAllocation {
+    var allocations []PodAllocation
+    for i := range pods {
+        if isTerminated(&pods[i]) && !opts.IncludeTerminated {
+            continue
+        }
+        allocations = append(allocations, newPodAllocation(&pods[i], node, opts.Basis))
+    }
+    return allocations
+}
+
+// Keys sortPodAllocations accepts.
+const (
+    podSortCPU  = "cpu"
+    podSortRAM  = "ram"
+    podSortName = "name"
+)
+
+// sortPodAllocations sorts pods in place by CPU or RAM requests, largest
+// first, or by namespace and name. reverse flips the order.
+func sortPodAllocations(pods []PodAllocation, key string, reverse bool) {
+    less := func(a, b PodAllocation) bool {
+        switch key {
+        case podSortCPU:
+            if a.CPURequests != b.CPURequests {
+                return a.CPURequests > b.CPURequests
+            }
+            return a.RAMRequests > b.RAMRequests
+        case podSortRAM:
+            if a.RAMRequests != b.RAMRequests {
+                return a.RAMRequests > b.RAMRequests
+            }
+            return a.CPURequests > b.CPURequests
+        }
+        if a.Namespace != b.Namespace {
+            return a.Namespace < b.Namespace
+        }
+        return a.Name < b.Name
+    }
+    sort.SliceStable(pods, func(i, j int) bool {
+        if reverse {
+            return less(pods[j], pods[i])
+        }
+        return less(pods[i], pods[j])
+    })
+}
+
+// writePodTable writes the --node table, one row per pod.
+func writePodTable(out io.Writer, pods []PodAllocation, noHeaders bool) {
+    w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+    if !noHeaders {
+        fmt.Fprintln(w, "NAMESPACE\tNAME\tOWNER\tQOS CLASS\tPRIORITY CLASS\tCPU REQUESTS (Cores)\tCPU LIMITS (Cores)\tCPU SHARE (%)\tRAM REQUESTS (GB)\tRAM LIMITS (GB)\tRAM SHARE (%)")
+    }
+    for _, pod := range pods {
+        owner := "<none>"
+        if pod.OwnerKind != "" {
+            owner = pod.OwnerKind + "/" + pod.OwnerName
+        }
+        priorityClass := pod.PriorityClass
+        if priorityClass == "" {
+            priorityClass = "<none>"
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\n",
+            pod.Namespace, pod.Name, owner, pod.QOSClass, priorityClass,
+            pod.CPURequests, pod.CPULimits, pod.CPUSharePct,
+            pod.RAMRequests, pod.RAMLimits, pod.RAMSharePct)
+    }
+    w.Flush()
+}
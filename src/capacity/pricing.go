@@ -0,0 +1,93 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "os"
+    "sort"
+
+    corev1 "k8s.io/api/core/v1"
+    "sigs.k8s.io/yaml"
+)
+
+// priceTable is the --pricing file: the hourly cost of a node by the value
+// of one of its labels, e.g.
+//
+//     label: node.kubernetes.io/instance-type
+//     prices:
+//       m5.large: 0.096
+//       m5.xlarge: 0.192
+//     default: 0.1
+//
+// Label defaults to node.kubernetes.io/instance-type. Nodes whose label
+// value is not listed cost Default, or nothing if it is not set.
+type priceTable struct {
+    Label   string             `json:"label"`
+    Prices  map[string]float64 `json:"prices"`
+    Default *float64           `json:"default"`
+}
+
+// readPriceTable reads a --pricing file, which may be YAML or JSON.
+func readPriceTable(path string) (*priceTable, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var table priceTable
+    if err := yaml.UnmarshalStrict(data, &table); err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    if len(table.Prices) == 0 && table.Default == nil {
+        return nil, fmt.Errorf("%s: no prices given", path)
+    }
+    if table.Label == "" {
+        table.Label = corev1.LabelInstanceTypeStable
+    }
+    return &table, nil
+}
+
+// nodePrice returns the hourly cost of a node, and false if the table has
+// no price for it.
+func (t *priceTable) nodePrice(node *corev1.Node) (float64, bool) {
+    if price, ok := t.Prices[node.Labels[t.Label]]; ok {
+        return price, true
+    }
+    if t.Default != nil {
+        return *t.Default, true
+    }
+    return 0, false
+}
+
+// unpriced returns the names of the nodes the table has no price for.
+func (t *priceTable) unpriced(nodes []corev1.Node) []string {
+    var names []string
+    for i := range nodes {
+        if _, ok := t.nodePrice(&nodes[i]); !ok {
+            names = append(names, nodes[i].Name)
+        }
+    }
+    sort.Strings(names)
+    return names
+}
+
+// allocatedShare is the share of a node taken by the given CPU and memory
+// requests: the mean of the CPU and the memory share, capped at the whole
+// node. Costs are split by this share, so that a node half full of CPU
+// and empty of memory counts as a quarter used.
+func allocatedShare(cpu, cpuBasis, ram, ramBasis float64) float64 {
+    return math.Min((ratio(cpu, cpuBasis)+ratio(ram, ramBasis))/2, 1)
+}
+
+// applyPricing sets the hourly cost of a node allocation and the part of
+// it that pays for unrequested capacity.
+func applyPricing(alloc *NodeAllocation, node *corev1.Node, prices *priceTable) {
+    price, _ := prices.nodePrice(node)
+    used := allocatedShare(alloc.CPUAllocatedPct, 100, alloc.RAMAllocatedPct, 100)
+    alloc.HourlyCost = price
+    alloc.IdleHourlyCost = price * (1 - used)
+}
+
+var costColumns = []tableColumn{
+    floatColumn("hourly-cost", "HOURLY COST", func(a NodeAllocation) float64 { return a.HourlyCost }),
+    floatColumn("idle-hourly-cost", "IDLE HOURLY COST", func(a NodeAllocation) float64 { return a.IdleHourlyCost }),
+}
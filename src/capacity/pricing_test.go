@@ -0,0 +1,155 @@
+package main
+
+import (
+    "math"
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+)
+
+// pricedNode returns a node of the given instance type.
+func pricedNode(name, instanceType, cpu, memory string) corev1.Node {
+    node := testNode(name, cpu, memory, 110)
+    node.Labels[corev1.LabelInstanceTypeStable] = instanceType
+    return node
+}
+
+func TestReadPriceTable(t *testing.T) {
+    dir := t.TempDir()
+    write := func(name, content string) string {
+        path := filepath.Join(dir, name)
+        if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+            t.Fatal(err)
+        }
+        return path
+    }
+
+    table, err := readPriceTable(write("prices.yaml", "prices:\n  m5.large: 0.096\n"))
+    if err != nil {
+        t.Fatalf("readPriceTable: %s", err)
+    }
+    if table.Label != corev1.LabelInstanceTypeStable || table.Prices["m5.large"] != 0.096 || table.Default != nil {
+        t.Errorf("got %+v", table)
+    }
+
+    for name, content := range map[string]string{
+        "empty.yaml":   "label: pool\n",
+        "unknown.yaml": "prices:\n  m5.large: 0.096\ncurrency: EUR\n",
+    } {
+        if _, err := readPriceTable(write(name, content)); err == nil {
+            t.Errorf("%s: expected an error", name)
+        }
+    }
+}
+
+func TestNamespaceCostsAddUpToClusterCost(t *testing.T) {
+    prices := &priceTable{
+        Label:  corev1.LabelInstanceTypeStable,
+        Prices: map[string]float64{"m5.large": 0.1, "m5.xlarge": 0.2},
+    }
+    nodes := []corev1.Node{
+        pricedNode("large", "m5.large", "2", "8Gi"),
+        pricedNode("xlarge", "m5.xlarge", "4", "16Gi"),
+        pricedNode("mystery", "x9.huge", "8", "32Gi"),
+    }
+    pods := []corev1.Pod{
+        testPod("team-a", "web", "large", "1", "2Gi"),
+        testPod("team-a", "batch", "xlarge", "2", "4Gi"),
+        testPod("team-b", "db", "xlarge", "1", "8Gi"),
+        testPod("team-b", "cache", "mystery", "4", "16Gi"),
+    }
+
+    if missing := prices.unpriced(nodes); !reflect.DeepEqual(missing, []string{"mystery"}) {
+        t.Errorf("got unpriced nodes %v, want [mystery]", missing)
+    }
+
+    report := namespaceAllocations(nodes, podsByNode(pods), nil, reportOptions{Basis: basisAllocatable, Pricing: prices})
+    near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+    if !near(report.ClusterHourlyCost, 0.3) {
+        t.Errorf("got cluster cost %v, want 0.3", report.ClusterHourlyCost)
+    }
+    // Every pod takes 3/8 of its node; the pod on the unpriced node is free
+    want := map[string]float64{"team-a": 0.1*0.375 + 0.2*0.375, "team-b": 0.2 * 0.375}
+    var sum float64
+    for _, alloc := range report.Namespaces {
+        if !near(alloc.HourlyCost, want[alloc.Namespace]) {
+            t.Errorf("%s: got cost %v, want %v", alloc.Namespace, alloc.HourlyCost, want[alloc.Namespace])
+        }
+        sum += alloc.HourlyCost
+    }
+    if !near(sum, report.Total.HourlyCost) {
+        t.Errorf("namespace costs add up to %v, total says %v", sum, report.Total.HourlyCost)
+    }
+    if !near(sum+report.IdleHourlyCost, report.ClusterHourlyCost) {
+        t.Errorf("namespace costs %v plus idle cost %v do not add up to the cluster cost %v", sum, report.IdleHourlyCost, report.ClusterHourlyCost)
+    }
+}
+
+func TestNamespaceCostsOnOvercommittedNode(t *testing.T) {
+    prices := &priceTable{
+        Label:  corev1.LabelInstanceTypeStable,
+        Prices: map[string]float64{"m5.large": 0.1},
+    }
+    nodes := []corev1.Node{pricedNode("large", "m5.large", "2", "8Gi")}
+    // Each pod takes 3/4 of the node, 3/2 together
+    pods := []corev1.Pod{
+        testPod("team-a", "web", "large", "2", "4Gi"),
+        testPod("team-b", "db", "large", "2", "4Gi"),
+    }
+
+    report := namespaceAllocations(nodes, podsByNode(pods), nil, reportOptions{Basis: basisAllocatable, Pricing: prices})
+    near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+    for _, alloc := range report.Namespaces {
+        if !near(alloc.HourlyCost, 0.05) {
+            t.Errorf("%s: got cost %v, want half the node, 0.05", alloc.Namespace, alloc.HourlyCost)
+        }
+    }
+    if !near(report.Total.HourlyCost, report.ClusterHourlyCost) {
+        t.Errorf("namespace costs add up to %v, want the node cost %v", report.Total.HourlyCost, report.ClusterHourlyCost)
+    }
+    if !near(report.IdleHourlyCost, 0) {
+        t.Errorf("got idle cost %v, want 0", report.IdleHourlyCost)
+    }
+}
+
+func TestNodeCosts(t *testing.T) {
+    nodes := []corev1.Node{
+        pricedNode("large", "m5.large", "2", "8Gi"),
+        pricedNode("mystery", "x9.huge", "8", "32Gi"),
+    }
+    pods := []corev1.Pod{
+        testPod("team-a", "web", "large", "1", "2Gi"),
+        testPod("team-b", "cache", "mystery", "4", "16Gi"),
+    }
+
+    prices := &priceTable{Label: corev1.LabelInstanceTypeStable, Prices: map[string]float64{"m5.large": 0.1}}
+    allocations := buildAllocations(nodes, podsByNode(pods), nil, reportOptions{Basis: basisAllocatable, Pricing: prices})
+    large, err := findAllocation(allocations, "large")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if large.HourlyCost != 0.1 || math.Abs(large.IdleHourlyCost-0.1*0.625) > 1e-9 {
+        t.Errorf("large: got cost %v and idle cost %v, want 0.1 and 0.0625", large.HourlyCost, large.IdleHourlyCost)
+    }
+    mystery, err := findAllocation(allocations, "mystery")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if mystery.HourlyCost != 0 || mystery.IdleHourlyCost != 0 {
+        t.Errorf("unpriced node: got cost %v and idle cost %v, want 0", mystery.HourlyCost, mystery.IdleHourlyCost)
+    }
+
+    // With a default every node has a price
+    fallback := 0.5
+    prices.Default = &fallback
+    if missing := prices.unpriced(nodes); len(missing) != 0 {
+        t.Errorf("got unpriced nodes %v with a default price", missing)
+    }
+    allocations = buildAllocations(nodes, podsByNode(pods), nil, reportOptions{Basis: basisAllocatable, Pricing: prices})
+    if mystery, _ = findAllocation(allocations, "mystery"); mystery.HourlyCost != 0.5 {
+        t.Errorf("got cost %v, want the default 0.5", mystery.HourlyCost)
+    }
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "math"
+    "os"
+    "sort"
+    "text/tabwriter"
+
+    corev1 "k8s.io/api/core/v1"
+    metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// Floors for suggested requests, so that idle containers are not
+// suggested requests of zero.
+const (
+    minSuggestedCPU = 10               // millicores
+    minSuggestedRAM = 16 * 1024 * 1024 // bytes
+)
+
+// Recommendation is the suggested requests and limits of one container of
+// a workload. Usage is the highest observed across the workload's pods;
+// the reclaimed figures are summed over those pods and are negative when
+// the suggestion is larger than the current requests. Suggested limits
+// keep the current limit to request ratio and are zero when the container
+// has no limit.
+type Recommendation struct {
+    Namespace         string  `json:"namespace" yaml:"namespace"`
+    Kind              string  `json:"kind" yaml:"kind"`
+    Name              string  `json:"name" yaml:"name"`
+    Container         string  `json:"container" yaml:"container"`
+    Pods              int     `json:"pods" yaml:"pods"`
+    CPURequest        float64 `json:"cpu_request" yaml:"cpu_request"`
+    CPULimit          float64 `json:"cpu_limit" yaml:"cpu_limit"`
+    CPUUsage          float64 `json:"cpu_usage" yaml:"cpu_usage"`
+    CPUSuggested      float64 `json:"cpu_suggested" yaml:"cpu_suggested"`
+    CPULimitSuggested float64 `json:"cpu_limit_suggested" yaml:"cpu_limit_suggested"`
+    CPUReclaimed      float64 `json:"cpu_reclaimed" yaml:"cpu_reclaimed"`
+    RAMRequest        float64 `json:"ram_request" yaml:"ram_request"`
+    RAMLimit          float64 `json:"ram_limit" yaml:"ram_limit"`
+    RAMUsage          float64 `json:"ram_usage" yaml:"ram_usage"`
+    RAMSuggested      float64 `json:"ram_suggested" yaml:"ram_suggested"`
+    RAMLimitSuggested float64 `json:"ram_limit_suggested" yaml:"ram_limit_suggested"`
+    RAMReclaimed      float64 `json:"ram_reclaimed" yaml:"ram_reclaimed"`
+}
+
+// RecommendationReport is the output of the recommend command. CPUReclaimed
+// and RAMReclaimed are the requests the cluster would get back if every
+// suggestion were applied.
+type RecommendationReport struct {
+    HeadroomPct     float64          `json:"headroom_pct" yaml:"headroom_pct"`
+    Recommendations []Recommendation `json:"recommendations" yaml:"recommendations"`
+    CPUReclaimed    float64          `json:"cpu_reclaimed" yaml:"cpu_reclaimed"`
+    RAMReclaimed    float64          `json:"ram_reclaimed" yaml:"ram_reclaimed"`
+}
+
+func runRecommend(args []string) {
+    fs := flag.NewFlagSet("recommend", flag.ExitOnError)
+    kubeconfig := fs.String("kubeconfig", "", "absolute path to the kubeconfig file")
+    contextName := fs.String("context", "", "name of the kubeconfig context to use")
+    outputFormat := fs.String("output", "table", "output format: table, json, yaml (use -o for short form)")
+    noHeaders := fs.Bool("no-headers", false, "if true, omit header row in output")
+    namespace := fs.String("namespace", "", "if set, only recommend for workloads in this namespace")
+    headroom := fs.Float64("headroom", 20, "percentage added on top of the observed usage for the suggested requests")
+
+    // Short flags
+    outputFlag := fs.String("o", "table", "output format: table, json, yaml")
+    namespaceFlag := fs.String("n", "", "if set, only recommend for workloads in this namespace")
+
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kubectl pod-capacity recommend [flags]\n\n")
+        fmt.Fprintf(os.Stderr, "This command compares the requests of every workload's containers with their usage from the metrics.k8s.io API and suggests requests and limits\n\n")
+        fmt.Fprintf(os.Stderr, "Flags:\n")
+        fmt.Fprintf(os.Stderr, "  -n, --namespace string   if set, only recommend for workloads in this namespace\n")
+        fmt.Fprintf(os.Stderr, "  --headroom float         percentage added on top of the observed usage for the suggested requests (default 20)\n")
+        fmt.Fprintf(os.Stderr, "  -o, --output string      output format: table, json, yaml\n")
+        fmt.Fprintf(os.Stderr, "  --kubeconfig string      absolute path to the kubeconfig file\n")
+        fmt.Fprintf(os.Stderr, "  --context string         name of the kubeconfig context to use\n")
+        fmt.Fprintf(os.Stderr, "  --no-headers             if true, omit header row in output\n")
+    }
+
+    fs.Parse(args)
+
+    if *outputFlag != "table" {
+        *outputFormat = *outputFlag
+    }
+    if *namespaceFlag != "" {
+        *namespace = *namespaceFlag
+    }
+    if *headroom < 0 {
+        fmt.Println("Invalid headroom. It must be zero or more.")
+        os.Exit(1)
+    }
+
+    config := buildConfig(*kubeconfig, *contextName)
+    clientset := newClientset(config)
+
+    pods, err := listPods(clientset)
+    if err != nil {
+        fmt.Printf("Error fetching pods: %s\n", err.Error())
+        os.Exit(1)
+    }
+    metricsClient, err := metricsclientset.NewForConfig(config)
+    if err != nil {
+        fmt.Printf("Error creating metrics client: %s\n", err.Error())
+        os.Exit(1)
+    }
+    usage, err := fetchPodUsage(metricsClient)
+    if err != nil {
+        fmt.Printf("Error fetching pod metrics, is metrics-server installed? %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    if *namespace != "" {
+        var filtered []corev1.Pod
+        for _, pod := range pods {
+            if pod.Namespace == *namespace {
+                filtered = append(filtered, pod)
+            }
+        }
+        pods = filtered
+    }
+    report := recommend(pods, usage, *headroom, newWorkloadResolver(clientset).workload)
+
+    switch *outputFormat {
+    case "json":
+        outputJSON(report)
+    case "yaml":
+        outputYAML(report)
+    case "table":
+        writeRecommendationTable(os.Stdout, report, *noHeaders)
+    default:
+        fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
+        os.Exit(1)
+    }
+}
+
+// containerSample is what one pod tells about a container of its workload.
+type containerSample struct {
+    CPURequest, CPULimit, CPUUsage int64 // millicores
+    RAMRequest, RAMLimit, RAMUsage int64 // bytes
+}
+
+// recommend groups the containers of running pods by the workload returned
+// by workload, and suggests requests of the highest usage among the
+// workload's pods plus headroom percent. Pods without metrics, such as
+// those that just started, are left out. Recommendations are ordered by
+// reclaimed CPU, largest first.
+func recommend(pods []corev1.Pod, usage map[string]map[string]containerUsage, headroom float64, workload func(*corev1.Pod) (string, string)) RecommendationReport {
+    report := RecommendationReport{HeadroomPct: headroom}
+    samples := make(map[Recommendation][]containerSample)
+    for i := range pods {
+        pod := &pods[i]
+        podUsage, ok := usage[pod.Namespace+"/"+pod.Name]
+        if !ok || isTerminated(pod) {
+            continue
+        }
+        kind, name := workload(pod)
+        if kind == "" {
+            kind, name = "Pod", pod.Name
+        }
+        for _, container := range pod.Spec.Containers {
+            observed, ok := podUsage[container.Name]
+            if !ok {
+                continue
+            }
+            key := Recommendation{Namespace: pod.Namespace, Kind: kind, Name: name, Container: container.Name}
+            samples[key] = append(samples[key], containerSample{
+                CPURequest: container.Resources.Requests.Cpu().MilliValue(),
+                CPULimit:   container.Resources.Limits.Cpu().MilliValue(),
+                CPUUsage:   observed.CPUUsage,
+                RAMRequest: container.Resources.Requests.Memory().Value(),
+                RAMLimit:   container.Resources.Limits.Memory().Value(),
+                RAMUsage:   observed.RAMUsage,
+            })
+        }
+    }
+
+    for key, containerSamples := range samples {
+        report.Recommendations = append(report.Recommendations, newRecommendation(key, containerSamples, headroom))
+    }
+    for _, rec := range report.Recommendations {
+        report.CPUReclaimed += rec.CPUReclaimed
+        report.RAMReclaimed += rec.RAMReclaimed
+    }
+    sort.Slice(report.Recommendations, func(i, j int) bool {
+        a, b := report.Recommendations[i], report.Recommendations[j]
+        if a.CPUReclaimed != b.CPUReclaimed {
+            return a.CPUReclaimed > b.CPUReclaimed
+        }
+        if a.Namespace != b.Namespace {
+            return a.Namespace < b.Namespace
+        }
+        if a.Name != b.Name {
+            return a.Name < b.Name
+        }
+        return a.Container < b.Container
+    })
+    return report
+}
+
+// newRecommendation works out the suggestion for one container from its
+// samples. CPU is rounded up to the millicore and memory to the MiB.
+func newRecommendation(rec Recommendation, samples []containerSample, headroom float64) Recommendation {
+    var highest containerSample
+    for _, sample := range samples {
+        highest.CPURequest = max(highest.CPURequest, sample.CPURequest)
+        highest.CPULimit = max(highest.CPULimit, sample.CPULimit)
+        highest.CPUUsage = max(highest.CPUUsage, sample.CPUUsage)
+        highest.RAMRequest = max(highest.RAMRequest, sample.RAMRequest)
+        highest.RAMLimit = max(highest.RAMLimit, sample.RAMLimit)
+        highest.RAMUsage = max(highest.RAMUsage, sample.RAMUsage)
+    }
+
+    factor := 1 + headroom/100
+    cpu := max(int64(math.Ceil(float64(highest.CPUUsage)*factor)), minSuggestedCPU)
+    const mib = 1024 * 1024
+    ram := max(int64(math.Ceil(float64(highest.RAMUsage)*factor/mib))*mib, minSuggestedRAM)
+
+    var cpuReclaimed, ramReclaimed int64
+    for _, sample := range samples {
+        cpuReclaimed += sample.CPURequest - cpu
+        ramReclaimed += sample.RAMRequest - ram
+    }
+
+    rec.Pods = len(samples)
+    rec.CPURequest = float64(highest.CPURequest) / 1000.0
+    rec.CPULimit = float64(highest.CPULimit) / 1000.0
+    rec.CPUUsage = float64(highest.CPUUsage) / 1000.0
+    rec.CPUSuggested = float64(cpu) / 1000.0
+    rec.CPULimitSuggested = float64(suggestedLimit(cpu, highest.CPURequest, highest.CPULimit, 1)) / 1000.0
+    rec.CPUReclaimed = float64(cpuReclaimed) / 1000.0
+    rec.RAMRequest = float64(highest.RAMRequest) / (1024 * 1024 * 1024)
+    rec.RAMLimit = float64(highest.RAMLimit) / (1024 * 1024 * 1024)
+    rec.RAMUsage = float64(highest.RAMUsage) / (1024 * 1024 * 1024)
+    rec.RAMSuggested = float64(ram) / (1024 * 1024 * 1024)
+    rec.RAMLimitSuggested = float64(suggestedLimit(ram, highest.RAMRequest, highest.RAMLimit, mib)) / (1024 * 1024 * 1024)
+    rec.RAMReclaimed = float64(ramReclaimed) / (1024 * 1024 * 1024)
+    return rec
+}
+
+// suggestedLimit scales the current limit with the suggested request,
+// rounded up to a multiple of unit. A container without a limit gets
+// none, and one without a request, whose request defaults to its limit,
+// gets the suggested request.
+func suggestedLimit(suggested, request, limit, unit int64) int64 {
+    if limit == 0 {
+        return 0
+    }
+    if request == 0 {
+        return suggested
+    }
+    scaled := float64(suggested) * float64(limit) / float64(request)
+    return int64(math.Ceil(scaled/float64(unit))) * unit
+}
+
+func writeRecommendationTable(out io.Writer, report RecommendationReport, noHeaders bool) {
+    w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+    if !noHeaders {
+        fmt.Fprintln(w, "NAMESPACE\tWORKLOAD\tCONTAINER\tPODS\tCPU REQUEST (Cores)\tCPU USAGE (Cores)\tCPU SUGGESTED (Cores)\tCPU LIMIT SUGGESTED (Cores)\tRAM REQUEST (GB)\tRAM USAGE (GB)\tRAM SUGGESTED (GB)\tRAM LIMIT SUGGESTED (GB)")
+    }
+    limitCell := func(value float64, format string) string {
+        if value == 0 {
+            return "-"
+        }
+        return fmt.Sprintf(format, value)
+    }
+    for _, rec := range report.Recommendations {
+        fmt.Fprintf(w, "%s\t%s/%s\t%s\t%d\t%.3f\t%.3f\t%.3f\t%s\t%.2f\t%.2f\t%.2f\t%s\n",
+            rec.Namespace, rec.Kind, rec.Name, rec.Container, rec.Pods,
+            rec.CPURequest, rec.CPUUsage, rec.CPUSuggested, limitCell(rec.CPULimitSuggested, "%.3f"),
+            rec.RAMRequest, rec.RAMUsage, rec.RAMSuggested, limitCell(rec.RAMLimitSuggested, "%.2f"))
+    }
+    w.Flush()
+
+    fmt.Fprintf(out, "\nApplying the suggestions with %.0f%% headroom would reclaim %.2f cores and %.2f GB of requests\n", report.HeadroomPct, report.CPUReclaimed, report.RAMReclaimed)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+    "math"
+    "testing"
+
+    appsv1 "k8s.io/api/apps/v1"
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes/fake"
+)
+
+const mib = 1024 * 1024
+
+func TestNewRecommendation(t *testing.T) {
+    tests := []struct {
+        name     string
+        samples  []containerSample
+        headroom float64
+        want     Recommendation
+    }{
+        {
+            name: "highest usage plus headroom, rounded up",
+            samples: []containerSample{
+                {CPURequest: 500, CPULimit: 1000, CPUUsage: 101, RAMRequest: 512 * mib, RAMLimit: 1024 * mib, RAMUsage: 100 * mib},
+                {CPURequest: 500, CPULimit: 1000, CPUUsage: 150, RAMRequest: 512 * mib, RAMLimit: 1024 * mib, RAMUsage: 200*mib + 1},
+            },
+            headroom: 20,
+            want: Recommendation{
+                Pods:       2,
+                CPURequest: 0.5, CPULimit: 1, CPUUsage: 0.15,
+                // 150m * 1.2, and twice the limit to request ratio
+                CPUSuggested: 0.18, CPULimitSuggested: 0.36, CPUReclaimed: 2 * 0.32,
+                RAMRequest: 0.5, RAMLimit: 1, RAMUsage: float64(200*mib+1) / (1024 * mib),
+                // 240.0000012Mi rounds up to 241Mi
+                RAMSuggested: 241.0 / 1024, RAMLimitSuggested: 482.0 / 1024, RAMReclaimed: 2 * 271.0 / 1024,
+            },
+        },
+        {
+            name: "idle containers get the floors",
+            samples: []containerSample{
+                {CPURequest: 100, RAMRequest: 64 * mib},
+            },
+            headroom: 20,
+            want: Recommendation{
+                Pods:       1,
+                CPURequest: 0.1, CPUSuggested: 0.01, CPUReclaimed: 0.09,
+                RAMRequest: 64.0 / 1024, RAMSuggested: 16.0 / 1024, RAMReclaimed: 48.0 / 1024,
+            },
+        },
+        {
+            name: "under-requested containers reclaim a negative amount",
+            samples: []containerSample{
+                {CPURequest: 100, CPUUsage: 400, RAMRequest: 128 * mib, RAMUsage: 256 * mib},
+            },
+            headroom: 0,
+            want: Recommendation{
+                Pods:       1,
+                CPURequest: 0.1, CPUUsage: 0.4, CPUSuggested: 0.4, CPUReclaimed: -0.3,
+                RAMRequest: 0.125, RAMUsage: 0.25, RAMSuggested: 0.25, RAMReclaimed: -0.125,
+            },
+        },
+        {
+            name: "a limit without a request follows the suggestion",
+            samples: []containerSample{
+                {CPULimit: 2000, CPUUsage: 1000, RAMLimit: 1024 * mib, RAMUsage: 512 * mib},
+            },
+            headroom: 50,
+            want: Recommendation{
+                Pods:     1,
+                CPULimit: 2, CPUUsage: 1, CPUSuggested: 1.5, CPULimitSuggested: 1.5, CPUReclaimed: -1.5,
+                RAMLimit: 1, RAMUsage: 0.5, RAMSuggested: 0.75, RAMLimitSuggested: 0.75, RAMReclaimed: -0.75,
+            },
+        },
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            got := newRecommendation(Recommendation{}, test.samples, test.headroom)
+            for _, check := range []struct {
+                field     string
+                got, want float64
+            }{
+                {"Pods", float64(got.Pods), float64(test.want.Pods)},
+                {"CPURequest", got.CPURequest, test.want.CPURequest},
+                {"CPULimit", got.CPULimit, test.want.CPULimit},
+                {"CPUUsage", got.CPUUsage, test.want.CPUUsage},
+                {"CPUSuggested", got.CPUSuggested, test.want.CPUSuggested},
+                {"CPULimitSuggested", got.CPULimitSuggested, test.want.CPULimitSuggested},
+                {"CPUReclaimed", got.CPUReclaimed, test.want.CPUReclaimed},
+                {"RAMRequest", got.RAMRequest, test.want.RAMRequest},
+                {"RAMLimit", got.RAMLimit, test.want.RAMLimit},
+                {"RAMUsage", got.RAMUsage, test.want.RAMUsage},
+                {"RAMSuggested", got.RAMSuggested, test.want.RAMSuggested},
+                {"RAMLimitSuggested", got.RAMLimitSuggested, test.want.RAMLimitSuggested},
+                {"RAMReclaimed", got.RAMReclaimed, test.want.RAMReclaimed},
+            } {
+                if math.Abs(check.got-check.want) > 1e-9 {
+                    t.Errorf("%s: got %v, want %v", check.field, check.got, check.want)
+                }
+            }
+        })
+    }
+}
+
+func TestSuggestedLimit(t *testing.T) {
+    tests := []struct {
+        name                            string
+        suggested, request, limit, unit int64
+        want                            int64
+    }{
+        {"no limit", 200, 100, 0, 1, 0},
+        {"no request", 200, 0, 500, 1, 200},
+        {"keeps the ratio", 200, 100, 300, 1, 600},
+        {"rounds up to the unit", 10 * mib, 3 * mib, 4 * mib, mib, 14 * mib},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            if got := suggestedLimit(test.suggested, test.request, test.limit, test.unit); got != test.want {
+                t.Errorf("got %d, want %d", got, test.want)
+            }
+        })
+    }
+}
+
+func TestWorkloadResolver(t *testing.T) {
+    controller := true
+    replicaSet := func(name string, owner *metav1.OwnerReference) *appsv1.ReplicaSet {
+        rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+        if owner != nil {
+            rs.OwnerReferences = []metav1.OwnerReference{*owner}
+        }
+        return rs
+    }
+    clientset := fake.NewClientset(
+        // Not named after the pod-template-hash, so podWorkload can't
+        // tell the Deployment
+        replicaSet("web-v2", &metav1.OwnerReference{Kind: "Deployment", Name: "web", Controller: &controller}),
+        replicaSet("canary-5d9f", &metav1.OwnerReference{Kind: "Rollout", Name: "canary", Controller: &controller}),
+        replicaSet("standalone", nil),
+    )
+    resolver := newWorkloadResolver(clientset)
+
+    withHash := func(pod corev1.Pod, hash string) corev1.Pod {
+        pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: hash}
+        return pod
+    }
+    tests := []struct {
+        name     string
+        pod      corev1.Pod
+        wantKind string
+        wantName string
+    }{
+        {"deployment", withHash(ownedPod("default", "web-1", "", "", "", "ReplicaSet", "web-v2"), "7c8d"), "Deployment", "web"},
+        {"deployment again", withHash(ownedPod("default", "web-2", "", "", "", "ReplicaSet", "web-v2"), "7c8d"), "Deployment", "web"},
+        {"other controller", withHash(ownedPod("default", "canary-1", "", "", "", "ReplicaSet", "canary-5d9f"), "5d9f"), "Rollout", "canary"},
+        {"replica set without owner", ownedPod("default", "standalone-1", "", "", "", "ReplicaSet", "standalone"), "ReplicaSet", "standalone"},
+        {"deleted replica set", withHash(ownedPod("default", "api-1", "", "", "", "ReplicaSet", "api-6b4f"), "6b4f"), "Deployment", "api"},
+        {"stateful set", ownedPod("default", "db-0", "", "", "", "StatefulSet", "db"), "StatefulSet", "db"},
+        {"bare pod", testPod("default", "debug", "", "", ""), "", ""},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            kind, name := resolver.workload(&test.pod)
+            if kind != test.wantKind || name != test.wantName {
+                t.Errorf("got %s/%s, want %s/%s", kind, name, test.wantKind, test.wantName)
+            }
+        })
+    }
+
+    // web-v2, canary-5d9f, standalone and api-6b4f are each fetched once
+    gets := 0
+    for _, action := range clientset.Actions() {
+        if action.GetVerb() == "get" {
+            gets++
+        }
+    }
+    if gets != 4 {
+        t.Errorf("got %d ReplicaSet lookups, want 4", gets)
+    }
+}
+
+func TestRecommendGroupsByWorkload(t *testing.T) {
+    pods := []corev1.Pod{
+        ownedPod("default", "web-1", "node-a", "500m", "512Mi", "StatefulSet", "web"),
+        ownedPod("default", "web-2", "node-b", "500m", "512Mi", "StatefulSet", "web"),
+        // No metrics yet
+        ownedPod("default", "web-3", "node-b", "500m", "512Mi", "StatefulSet", "web"),
+        testPod("default", "debug", "node-a", "100m", "64Mi"),
+    }
+    usage := map[string]map[string]containerUsage{
+        "default/web-1": {"app": {CPUUsage: 100, RAMUsage: 100 * mib}},
+        "default/web-2": {"app": {CPUUsage: 200, RAMUsage: 50 * mib}},
+        "default/debug": {"app": {CPUUsage: 1, RAMUsage: 1 * mib}},
+    }
+
+    report := recommend(pods, usage, 0, podWorkload)
+    if len(report.Recommendations) != 2 {
+        t.Fatalf("got %d recommendations, want 2: %+v", len(report.Recommendations), report.Recommendations)
+    }
+    web := report.Recommendations[0]
+    if web.Kind != "StatefulSet" || web.Name != "web" || web.Container != "app" || web.Pods != 2 || web.CPUSuggested != 0.2 {
+        t.Errorf("got %+v, want web with 2 pods and 200m suggested", web)
+    }
+    debug := report.Recommendations[1]
+    if debug.Kind != "Pod" || debug.Name != "debug" {
+        t.Errorf("got %s/%s, want the bare pod by name", debug.Kind, debug.Name)
+    }
+    if math.Abs(report.CPUReclaimed-(web.CPUReclaimed+debug.CPUReclaimed)) > 1e-9 {
+        t.Errorf("got %v cores reclaimed in total", report.CPUReclaimed)
+    }
+}
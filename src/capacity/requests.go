@@ -0,0 +1,141 @@
+package main
+
+import (
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// podRequests returns the effective resource requests of a pod, computed the
+// same way kube-scheduler and `kubectl describe node` account for them:
+//
+//   - regular containers are summed
+//   - restartable (sidecar) init containers run alongside the regular
+//     containers, so they are added to the sum
+//   - regular init containers run one at a time before the pod starts, so
+//     the pod needs the largest of them (plus any sidecars started before
+//     it) or the running sum, whichever is bigger
+//   - pod-level resources, when set, replace the container aggregate for
+//     the resources they specify
+//   - pod overhead is added on top
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+    requests := effectivePodResources(pod, func(r corev1.ResourceRequirements) corev1.ResourceList {
+        return r.Requests
+    })
+    addResourceList(requests, pod.Spec.Overhead)
+    return requests
+}
+
+// effectivePodResources applies the scheduler's pod resource formula,
+// without the pod overhead, to the resource list selected by get from each
+// container.
+func effectivePodResources(pod *corev1.Pod, get func(corev1.ResourceRequirements) corev1.ResourceList) corev1.ResourceList {
+    total := corev1.ResourceList{}
+    for _, container := range pod.Spec.Containers {
+        addResourceList(total, get(container.Resources))
+    }
+
+    restartableInit := corev1.ResourceList{}
+    initMax := corev1.ResourceList{}
+    for _, container := range pod.Spec.InitContainers {
+        containerResources := get(container.Resources)
+        var required corev1.ResourceList
+        if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+            // Sidecars keep running, so they count towards the steady state
+            // as well as towards every init container started after them.
+            addResourceList(total, containerResources)
+            addResourceList(restartableInit, containerResources)
+            required = restartableInit
+        } else {
+            required = corev1.ResourceList{}
+            addResourceList(required, containerResources)
+            addResourceList(required, restartableInit)
+        }
+        maxResourceList(initMax, required)
+    }
+    maxResourceList(total, initMax)
+
+    if pod.Spec.Resources != nil {
+        for name, quantity := range get(*pod.Spec.Resources) {
+            // Only CPU and memory are supported at the pod level
+            if name == corev1.ResourceCPU || name == corev1.ResourceMemory {
+                total[name] = quantity.DeepCopy()
+            }
+        }
+    }
+    return total
+}
+
+// addResourceList adds every quantity in delta to total.
+func addResourceList(total, delta corev1.ResourceList) {
+    for name, quantity := range delta {
+        if current, ok := total[name]; ok {
+            current.Add(quantity)
+            total[name] = current
+        } else {
+            total[name] = quantity.DeepCopy()
+        }
+    }
+}
+
+// subtractResourceList subtracts every quantity in delta from total.
+func subtractResourceList(total, delta corev1.ResourceList) {
+    for name, quantity := range delta {
+        current, ok := total[name]
+        if !ok {
+            current = *resource.NewQuantity(0, quantity.Format)
+        }
+        current.Sub(quantity)
+        total[name] = current
+    }
+}
+
+// maxResourceList raises every quantity in total to at least the matching
+// quantity in other.
+func maxResourceList(total, other corev1.ResourceList) {
+    for name, quantity := range other {
+        if current, ok := total[name]; !ok || quantity.Cmp(current) > 0 {
+            total[name] = quantity.DeepCopy()
+        }
+    }
+}
+
+// podLimits returns the effective resource limits of a pod using the same
+// formula as podRequests. Containers without a limit contribute nothing, so
+// the result is the sum of the limits that are actually set. Pod overhead
+// is only added to resources the pod has a limit for, as an unlimited
+// resource stays unlimited.
+func podLimits(pod *corev1.Pod) corev1.ResourceList {
+    limits := effectivePodResources(pod, func(r corev1.ResourceRequirements) corev1.ResourceList {
+        return r.Limits
+    })
+    for name, quantity := range pod.Spec.Overhead {
+        if current, ok := limits[name]; ok && !current.IsZero() {
+            current.Add(quantity)
+            limits[name] = current
+        }
+    }
+    return limits
+}
+
+// hasLimits reports whether a pod is bounded in both CPU and memory, either
+// through pod-level limits or through a limit on every container. Pods that
+// are not (BestEffort and most Burstable pods) can grow until the node runs
+// out of memory.
+func hasLimits(pod *corev1.Pod) bool {
+    if pod.Spec.Resources != nil {
+        _, hasCPU := pod.Spec.Resources.Limits[corev1.ResourceCPU]
+        _, hasRAM := pod.Spec.Resources.Limits[corev1.ResourceMemory]
+        if hasCPU && hasRAM {
+            return true
+        }
+    }
+    containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+    for _, container := range containers {
+        _, hasCPU := container.Resources.Limits[corev1.ResourceCPU]
+        _, hasRAM := container.Resources.Limits[corev1.ResourceMemory]
+        if !hasCPU || !hasRAM {
+            return false
+        }
+    }
+    return true
+}
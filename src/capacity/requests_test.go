@@ -0,0 +1,160 @@
+package main
+
+import (
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    resourcehelper "k8s.io/component-helpers/resource"
+)
+
+// resourceList builds a CPU and memory resource list, leaving out the
+// resources given as "".
+func resourceList(cpu, memory string) corev1.ResourceList {
+    list := corev1.ResourceList{}
+    if cpu != "" {
+        list[corev1.ResourceCPU] = resource.MustParse(cpu)
+    }
+    if memory != "" {
+        list[corev1.ResourceMemory] = resource.MustParse(memory)
+    }
+    return list
+}
+
+// testContainer returns a container with the given requests and limits.
+func testContainer(name string, requests, limits corev1.ResourceList) corev1.Container {
+    return corev1.Container{
+        Name:      name,
+        Resources: corev1.ResourceRequirements{Requests: requests, Limits: limits},
+    }
+}
+
+// sidecar turns a container into a restartable init container.
+func sidecar(container corev1.Container) corev1.Container {
+    always := corev1.ContainerRestartPolicyAlways
+    container.RestartPolicy = &always
+    return container
+}
+
+// assertResourceList fails the test unless got and want hold the same
+// quantities, ignoring zero quantities missing on either side.
+func assertResourceList(t *testing.T, got, want corev1.ResourceList) {
+    t.Helper()
+    for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+        gotQuantity, wantQuantity := got[name], want[name]
+        if gotQuantity.Cmp(wantQuantity) != 0 {
+            t.Errorf("%s: got %s, want %s", name, gotQuantity.String(), wantQuantity.String())
+        }
+    }
+}
+
+var podResourceTests = []struct {
+    name         string
+    spec         corev1.PodSpec
+    wantRequests corev1.ResourceList
+    wantLimits   corev1.ResourceList
+}{
+    {
+        name: "containers are summed",
+        spec: corev1.PodSpec{
+            Containers: []corev1.Container{
+                testContainer("a", resourceList("100m", "128Mi"), resourceList("200m", "256Mi")),
+                testContainer("b", resourceList("300m", "64Mi"), resourceList("400m", "64Mi")),
+            },
+        },
+        wantRequests: resourceList("400m", "192Mi"),
+        wantLimits:   resourceList("600m", "320Mi"),
+    },
+    {
+        name: "largest init container wins over the container sum",
+        spec: corev1.PodSpec{
+            InitContainers: []corev1.Container{
+                testContainer("init-a", resourceList("1", "64Mi"), nil),
+                testContainer("init-b", resourceList("500m", "1Gi"), nil),
+            },
+            Containers: []corev1.Container{
+                testContainer("a", resourceList("200m", "256Mi"), nil),
+                testContainer("b", resourceList("200m", "256Mi"), nil),
+            },
+        },
+        wantRequests: resourceList("1", "1Gi"),
+    },
+    {
+        name: "container sum wins over a smaller init container",
+        spec: corev1.PodSpec{
+            InitContainers: []corev1.Container{
+                testContainer("init", resourceList("100m", "32Mi"), nil),
+            },
+            Containers: []corev1.Container{
+                testContainer("a", resourceList("200m", "256Mi"), nil),
+                testContainer("b", resourceList("200m", "256Mi"), nil),
+            },
+        },
+        wantRequests: resourceList("400m", "512Mi"),
+    },
+    {
+        name: "sidecars count towards the containers and later init containers",
+        spec: corev1.PodSpec{
+            InitContainers: []corev1.Container{
+                sidecar(testContainer("proxy", resourceList("100m", "128Mi"), resourceList("200m", "128Mi"))),
+                testContainer("migrate", resourceList("1", "256Mi"), resourceList("1", "256Mi")),
+            },
+            Containers: []corev1.Container{
+                testContainer("app", resourceList("500m", "512Mi"), resourceList("1", "1Gi")),
+            },
+        },
+        wantRequests: resourceList("1100m", "640Mi"),
+        wantLimits:   resourceList("1200m", "1152Mi"),
+    },
+    {
+        name: "overhead is added on top",
+        spec: corev1.PodSpec{
+            Containers: []corev1.Container{
+                testContainer("app", resourceList("250m", "256Mi"), resourceList("500m", "")),
+            },
+            Overhead: resourceList("100m", "64Mi"),
+        },
+        wantRequests: resourceList("350m", "320Mi"),
+        wantLimits:   resourceList("600m", ""),
+    },
+    {
+        name: "pod-level resources replace the container aggregate",
+        spec: corev1.PodSpec{
+            Containers: []corev1.Container{
+                testContainer("a", resourceList("100m", "128Mi"), nil),
+                testContainer("b", resourceList("100m", "128Mi"), nil),
+            },
+            Resources: &corev1.ResourceRequirements{
+                Requests: resourceList("1", ""),
+                Limits:   resourceList("2", "2Gi"),
+            },
+            Overhead: resourceList("50m", "32Mi"),
+        },
+        wantRequests: resourceList("1050m", "288Mi"),
+        wantLimits:   resourceList("2050m", "2080Mi"),
+    },
+}
+
+func TestPodRequests(t *testing.T) {
+    for _, test := range podResourceTests {
+        t.Run(test.name, func(t *testing.T) {
+            pod := &corev1.Pod{Spec: test.spec}
+            got := podRequests(pod)
+            assertResourceList(t, got, test.wantRequests)
+            assertResourceList(t, got, resourcehelper.PodRequests(pod, resourcehelper.PodResourcesOptions{}))
+        })
+    }
+}
+
+func TestPodLimits(t *testing.T) {
+    for _, test := range podResourceTests {
+        t.Run(test.name, func(t *testing.T) {
+            pod := &corev1.Pod{Spec: test.spec}
+            got := podLimits(pod)
+            if test.wantLimits != nil {
+                assertResourceList(t, got, test.wantLimits)
+            }
+            assertResourceList(t, got, resourcehelper.PodLimits(pod, resourcehelper.PodResourcesOptions{}))
+        })
+    }
+}
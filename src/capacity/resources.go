@@ -0,0 +1,98 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ResourceAllocation is the capacity and allocation of a single resource on
+// a node. Values are in cores for cpu, in GB for memory, ephemeral-storage
+// and hugepages, and in whole units for everything else (e.g. GPUs).
+type ResourceAllocation struct {
+    Capacity    float64 `json:"capacity" yaml:"capacity"`
+    Allocatable float64 `json:"allocatable" yaml:"allocatable"`
+    Allocated   float64 `json:"allocated" yaml:"allocated"`
+    Available   float64 `json:"available" yaml:"available"`
+}
+
+// parseResourceNames splits the comma separated --resources value into
+// resource names, dropping empty entries and duplicates.
+func parseResourceNames(value string) []corev1.ResourceName {
+    var names []corev1.ResourceName
+    seen := make(map[string]bool)
+    for _, name := range strings.Split(value, ",") {
+        name = strings.TrimSpace(name)
+        if name == "" || seen[name] {
+            continue
+        }
+        seen[name] = true
+        names = append(names, corev1.ResourceName(name))
+    }
+    return names
+}
+
+// newResourceAllocation reports a single resource of a node. Available is
+// computed against basisResources, which is either the node's allocatable
+// resources or its capacity.
+func newResourceAllocation(name corev1.ResourceName, node corev1.Node, basisResources corev1.ResourceList, totals podTotals) ResourceAllocation {
+    capacity := node.Status.Capacity[name]
+    allocatable := node.Status.Allocatable[name]
+    allocated := totals.Requests[name]
+    available := basisResources[name].DeepCopy()
+    available.Sub(allocated)
+    return ResourceAllocation{
+        Capacity:    resourceValue(name, capacity),
+        Allocatable: resourceValue(name, allocatable),
+        Allocated:   resourceValue(name, allocated),
+        Available:   resourceValue(name, available),
+    }
+}
+
+// isByteResource reports whether a resource is measured in bytes.
+func isByteResource(name corev1.ResourceName) bool {
+    return name == corev1.ResourceMemory ||
+        name == corev1.ResourceEphemeralStorage ||
+        strings.HasPrefix(string(name), corev1.ResourceHugePagesPrefix)
+}
+
+// resourceValue converts a quantity to the unit capacity reports the
+// resource in.
+func resourceValue(name corev1.ResourceName, quantity resource.Quantity) float64 {
+    value := quantity.AsApproximateFloat64()
+    if isByteResource(name) {
+        return value / (1024 * 1024 * 1024)
+    }
+    return value
+}
+
+// resourceUnit returns the unit suffix used in table headers for a resource.
+func resourceUnit(name corev1.ResourceName) string {
+    switch {
+    case name == corev1.ResourceCPU:
+        return " (Cores)"
+    case isByteResource(name):
+        return " (GB)"
+    default:
+        return ""
+    }
+}
+
+// resourceColumns returns capacity, allocated and available table columns
+// for each of the given resources.
+func resourceColumns(resources []corev1.ResourceName) []tableColumn {
+    var columns []tableColumn
+    for _, name := range resources {
+        key := string(name)
+        header := strings.ToUpper(key)
+        unit := resourceUnit(name)
+        columns = append(columns,
+            floatColumn(key+"-capacity", fmt.Sprintf("%s CAPACITY%s", header, unit), func(a NodeAllocation) float64 { return a.Resources[key].Capacity }),
+            floatColumn(key+"-allocated", fmt.Sprintf("%s ALLOCATED%s", header, unit), func(a NodeAllocation) float64 { return a.Resources[key].Allocated }),
+            floatColumn(key+"-available", fmt.Sprintf("%s AVAILABLE%s", header, unit), func(a NodeAllocation) float64 { return a.Resources[key].Available }),
+        )
+    }
+    return columns
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "os/signal"
+    "regexp"
+    "sort"
+    "strings"
+    "syscall"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+)
+
+// metricPrefix is prepended to the name of every exported metric.
+const metricPrefix = "pod_capacity_node_"
+
+// invalidMetricChars matches the characters that are not allowed in
+// Prometheus metric and label names.
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func runServe(args []string) {
+    fs := flag.NewFlagSet("serve", flag.ExitOnError)
+    kubeconfig := fs.String("kubeconfig", "", "absolute path to the kubeconfig file")
+    contextName := fs.String("context", "", "name of the kubeconfig context to use")
+    listen := fs.String("listen", ":9090", "address to serve metrics on")
+    selector := fs.String("selector", "", "label selector to filter nodes")
+    basis := fs.String("basis", basisAllocatable, "node resources the available figures are computed from: allocatable, capacity")
+    includeTerminated := fs.Bool("include-terminated", false, "if true, count Succeeded and Failed pods towards pod counts and allocations")
+    resourceNames := fs.String("resources", "", "comma separated list of additional resources to export, e.g. nvidia.com/gpu,ephemeral-storage,hugepages-2Mi")
+    nodeLabels := fs.String("node-labels", "", "comma separated list of node labels to add to every metric, e.g. topology.kubernetes.io/zone")
+
+    // Short flags
+    selectorFlag := fs.String("l", "", "label selector to filter nodes")
+
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kubectl pod-capacity serve [flags]\n\n")
+        fmt.Fprintf(os.Stderr, "This command keeps node and pod informers running and exposes the node allocations as Prometheus gauges on /metrics\n\n")
+        fmt.Fprintf(os.Stderr, "Flags:\n")
+        fmt.Fprintf(os.Stderr, "  --listen string          address to serve metrics on (default :9090)\n")
+        fmt.Fprintf(os.Stderr, "  --kubeconfig string      absolute path to the kubeconfig file\n")
+        fmt.Fprintf(os.Stderr, "  --context string         name of the kubeconfig context to use\n")
+        fmt.Fprintf(os.Stderr, "  -l, --selector string    label selector to filter nodes\n")
+        fmt.Fprintf(os.Stderr, "  --basis string           node resources the available figures are computed from: allocatable, capacity (default allocatable)\n")
+        fmt.Fprintf(os.Stderr, "  --include-terminated     if true, count Succeeded and Failed pods towards pod counts and allocations\n")
+        fmt.Fprintf(os.Stderr, "  --resources string       comma separated list of additional resources to export, e.g. nvidia.com/gpu,ephemeral-storage,hugepages-2Mi\n")
+        fmt.Fprintf(os.Stderr, "  --node-labels string     comma separated list of node labels to add to every metric, e.g. topology.kubernetes.io/zone\n")
+    }
+
+    fs.Parse(args)
+
+    if *selectorFlag != "" {
+        *selector = *selectorFlag
+    }
+    if *basis != basisAllocatable && *basis != basisCapacity {
+        fmt.Println("Invalid basis. Supported values: allocatable, capacity.")
+        os.Exit(1)
+    }
+    opts := reportOptions{
+        Basis:             *basis,
+        IncludeTerminated: *includeTerminated,
+        Resources:         parseResourceNames(*resourceNames),
+    }
+
+    config := buildConfig(*kubeconfig, *contextName)
+    clientset := newClientset(config)
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    source, err := newWatchSource(ctx, clientset, *selector)
+    if err != nil {
+        fmt.Printf("Error watching cluster: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    mux := http.NewServeMux()
+    mux.Handle("/metrics", metricsHandler(source, opts, parseGroupBy(*nodeLabels)))
+    server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+    go func() {
+        <-ctx.Done()
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        server.Shutdown(shutdownCtx)
+    }()
+
+    fmt.Fprintf(os.Stderr, "Serving metrics on %s/metrics\n", *listen)
+    if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+        fmt.Printf("Error serving metrics: %s\n", err.Error())
+        os.Exit(1)
+    }
+}
+
+// metricsHandler computes the node allocations from the informer caches on
+// every scrape and writes them in the Prometheus text format.
+func metricsHandler(source *watchSource, opts reportOptions, nodeLabels []string) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        nodes, pods := source.snapshot()
+        allocations := buildAllocations(nodes, podsByNode(pods), nil, opts)
+        sort.SliceStable(allocations, func(i, j int) bool {
+            return allocations[i].NodeName < allocations[j].NodeName
+        })
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+        writeMetrics(w, allocations, opts.Resources, nodeLabels)
+    })
+}
+
+// writeMetrics writes one gauge per pod, CPU and RAM table column, named
+// after the column key, and a capacity, allocated and available gauge for
+// the extended resources with the resource as a label. Every sample is
+// labelled with the node name and the requested node labels, which are
+// renamed to label_<name> the way kube-state-metrics does.
+func writeMetrics(out io.Writer, allocations []NodeAllocation, resources []corev1.ResourceName, nodeLabels []string) {
+    labelSets := make([]string, len(allocations))
+    for i, alloc := range allocations {
+        labelSets[i] = metricLabels(alloc, nodeLabels)
+    }
+
+    var columns []tableColumn
+    columns = append(columns, podColumns...)
+    columns = append(columns, cpuColumns...)
+    columns = append(columns, ramColumns...)
+    for _, column := range columns {
+        name := metricPrefix + metricName(column.Key)
+        fmt.Fprintf(out, "# HELP %s %s\n", name, column.Header)
+        fmt.Fprintf(out, "# TYPE %s gauge\n", name)
+        for i, alloc := range allocations {
+            fmt.Fprintf(out, "%s{%s} %g\n", name, labelSets[i], column.Number(alloc))
+        }
+    }
+
+    if len(resources) == 0 {
+        return
+    }
+    resourceMetrics := []struct {
+        name  string
+        help  string
+        value func(ResourceAllocation) float64
+    }{
+        {"resource_capacity", "Capacity of an extended resource", func(r ResourceAllocation) float64 { return r.Capacity }},
+        {"resource_allocated", "Requests of an extended resource", func(r ResourceAllocation) float64 { return r.Allocated }},
+        {"resource_available", "Unrequested amount of an extended resource", func(r ResourceAllocation) float64 { return r.Available }},
+    }
+    for _, metric := range resourceMetrics {
+        name := metricPrefix + metric.name
+        fmt.Fprintf(out, "# HELP %s %s\n", name, metric.help)
+        fmt.Fprintf(out, "# TYPE %s gauge\n", name)
+        for i, alloc := range allocations {
+            for _, resourceName := range resources {
+                fmt.Fprintf(out, "%s{%s,resource=\"%s\"} %g\n", name, labelSets[i], escapeLabelValue(string(resourceName)), metric.value(alloc.Resources[string(resourceName)]))
+            }
+        }
+    }
+}
+
+// metricLabels renders the label set of a node's samples.
+func metricLabels(alloc NodeAllocation, nodeLabels []string) string {
+    labels := []string{fmt.Sprintf("node=\"%s\"", escapeLabelValue(alloc.NodeName))}
+    for _, key := range nodeLabels {
+        labels = append(labels, fmt.Sprintf("label_%s=\"%s\"", metricName(key), escapeLabelValue(alloc.Labels[key])))
+    }
+    return strings.Join(labels, ",")
+}
+
+// metricName turns a column key or label key into a valid metric or label
+// name, e.g. cpu-allocated-pct into cpu_allocated_pct.
+func metricName(key string) string {
+    return invalidMetricChars.ReplaceAllString(key, "_")
+}
+
+func escapeLabelValue(value string) string {
+    return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+    "context"
+    "io"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestMetricsHandler(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    gpuNode := testNode("gpu-a", "8", "32Gi", 110)
+    gpuNode.Labels["topology.kubernetes.io/zone"] = "eu-west-1a"
+    gpuNode.Status.Capacity["nvidia.com/gpu"] = resource.MustParse("4")
+    gpuNode.Status.Allocatable["nvidia.com/gpu"] = resource.MustParse("4")
+    plainNode := testNode("plain-b", "4", "16Gi", 110)
+    plainNode.Labels["topology.kubernetes.io/zone"] = "eu-west-1b"
+
+    training := testPod("ml", "training", "gpu-a", "2", "8Gi")
+    training.Spec.Containers[0].Resources.Requests["nvidia.com/gpu"] = resource.MustParse("1")
+    training.Spec.Containers[0].Resources.Limits = corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")}
+    web := testPod("default", "web", "plain-b", "500m", "1Gi")
+
+    clientset, _ := newWatchedClientset(&gpuNode, &plainNode, &training, &web)
+    source, err := newWatchSource(ctx, clientset, "")
+    if err != nil {
+        t.Fatalf("newWatchSource: %s", err)
+    }
+    opts := reportOptions{Basis: basisAllocatable, Resources: []corev1.ResourceName{"nvidia.com/gpu"}}
+    server := httptest.NewServer(metricsHandler(source, opts, []string{"topology.kubernetes.io/zone"}))
+    defer server.Close()
+
+    resp, err := server.Client().Get(server.URL + "/metrics")
+    if err != nil {
+        t.Fatalf("scraping metrics: %s", err)
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(resp.Body)
+    if err != nil {
+        t.Fatalf("reading metrics: %s", err)
+    }
+    if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+        t.Errorf("got content type %q", contentType)
+    }
+
+    samples := make(map[string]string)
+    for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+        if strings.HasPrefix(line, "#") {
+            continue
+        }
+        series, value, ok := strings.Cut(line, " ")
+        if !ok {
+            t.Fatalf("malformed sample %q", line)
+        }
+        samples[series] = value
+    }
+
+    gpuLabels := `node="gpu-a",label_topology_kubernetes_io_zone="eu-west-1a"`
+    plainLabels := `node="plain-b",label_topology_kubernetes_io_zone="eu-west-1b"`
+    want := map[string]string{
+        `pod_capacity_node_deployed_pods{` + gpuLabels + `}`:                                  "1",
+        `pod_capacity_node_available_pod_slots{` + gpuLabels + `}`:                            "109",
+        `pod_capacity_node_cpu_allocated{` + gpuLabels + `}`:                                  "2",
+        `pod_capacity_node_cpu_allocated_pct{` + gpuLabels + `}`:                              "25",
+        `pod_capacity_node_ram_available{` + gpuLabels + `}`:                                  "24",
+        `pod_capacity_node_cpu_available{` + plainLabels + `}`:                                "3.5",
+        `pod_capacity_node_ram_allocated{` + plainLabels + `}`:                                "1",
+        `pod_capacity_node_resource_capacity{` + gpuLabels + `,resource="nvidia.com/gpu"}`:    "4",
+        `pod_capacity_node_resource_allocated{` + gpuLabels + `,resource="nvidia.com/gpu"}`:   "1",
+        `pod_capacity_node_resource_available{` + gpuLabels + `,resource="nvidia.com/gpu"}`:   "3",
+        `pod_capacity_node_resource_capacity{` + plainLabels + `,resource="nvidia.com/gpu"}`:  "0",
+        `pod_capacity_node_resource_available{` + plainLabels + `,resource="nvidia.com/gpu"}`: "0",
+    }
+    for series, value := range want {
+        if got, ok := samples[series]; !ok {
+            t.Errorf("missing sample %s", series)
+        } else if got != value {
+            t.Errorf("%s: got %s, want %s", series, got, value)
+        }
+    }
+
+    if !strings.Contains(string(body), "# TYPE pod_capacity_node_cpu_allocated gauge\n") {
+        t.Error("cpu_allocated is not declared as a gauge")
+    }
+    for series := range samples {
+        if !strings.HasPrefix(series, metricPrefix) {
+            t.Errorf("sample %s does not start with %s", series, metricPrefix)
+        }
+    }
+}
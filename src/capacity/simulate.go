@@ -0,0 +1,100 @@
+package main
+
+import (
+    "fmt"
+    "math"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+    "k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
+)
+
+// nodeState is a node together with the resources still free on it. The
+// placement simulations draw from Free as they place pods on the node.
+type nodeState struct {
+    Node *corev1.Node
+    Free corev1.ResourceList
+}
+
+// newNodeStates computes the free resources of each node: its allocatable
+// resources (or capacity, depending on basis) minus the effective requests
+// of the pods bound to it. The pods resource is reduced by one per pod, so
+// that pod slots are checked like any other resource.
+func newNodeStates(nodes []corev1.Node, nodePods map[string][]corev1.Pod, basis string) []*nodeState {
+    states := make([]*nodeState, 0, len(nodes))
+    for i := range nodes {
+        node := &nodes[i]
+        basisResources := node.Status.Allocatable
+        if basis == basisCapacity {
+            basisResources = node.Status.Capacity
+        }
+        state := &nodeState{Node: node, Free: basisResources.DeepCopy()}
+        totals := aggregatePods(nodePods[node.Name], false)
+        subtractResourceList(state.Free, totals.Requests)
+        subtractResourceList(state.Free, corev1.ResourceList{
+            corev1.ResourcePods: *resource.NewQuantity(totals.PodCount, resource.DecimalSI),
+        })
+        states = append(states, state)
+    }
+    return states
+}
+
+// placementRequests returns what a pod takes from a node when it is placed:
+// its effective requests plus one pod slot.
+func placementRequests(pod *corev1.Pod) corev1.ResourceList {
+    requests := podRequests(pod)
+    requests[corev1.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+    return requests
+}
+
+// checkConstraints returns why a pod can never be placed on a node, whatever
+// its free resources, or "" if the node is eligible. It covers cordoned
+// nodes, nodeSelector, required node affinity and NoSchedule/NoExecute
+// taints.
+func checkConstraints(pod *corev1.Pod, node *corev1.Node) string {
+    if node.Spec.Unschedulable && !corev1helpers.TolerationsTolerateTaint(pod.Spec.Tolerations, &corev1.Taint{
+        Key:    corev1.TaintNodeUnschedulable,
+        Effect: corev1.TaintEffectNoSchedule,
+    }) {
+        return "node is cordoned"
+    }
+    if matches, _ := nodeaffinity.GetRequiredNodeAffinity(pod).Match(node); !matches {
+        return "node does not match the pod's node selector or affinity"
+    }
+    taint, untolerated := corev1helpers.FindMatchingUntoleratedTaint(node.Spec.Taints, pod.Spec.Tolerations, func(t *corev1.Taint) bool {
+        return t.Effect == corev1.TaintEffectNoSchedule || t.Effect == corev1.TaintEffectNoExecute
+    })
+    if untolerated {
+        return fmt.Sprintf("untolerated taint %s", taint.ToString())
+    }
+    return ""
+}
+
+// fitCount returns how many times requests fit into free. When the answer is
+// zero, reason names the resource that blocks placement.
+func fitCount(free, requests corev1.ResourceList) (count int64, reason string) {
+    count = math.MaxInt64
+    for name, request := range requests {
+        if request.IsZero() {
+            continue
+        }
+        available := free[name]
+        n := available.MilliValue() / request.MilliValue()
+        if n < 0 {
+            n = 0
+        }
+        if n < count {
+            count = n
+            if n == 0 {
+                reason = fmt.Sprintf("insufficient %s (requests %s, %s free)", name, request.String(), available.String())
+            }
+        }
+    }
+    return count, reason
+}
+
+// place subtracts requests from the node's free resources.
+func (n *nodeState) place(requests corev1.ResourceList) {
+    subtractResourceList(n.Free, requests)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+    "math"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestFitCount(t *testing.T) {
+    tests := []struct {
+        name       string
+        free       corev1.ResourceList
+        requests   corev1.ResourceList
+        wantCount  int64
+        wantReason string
+    }{
+        {
+            name:      "smallest quotient wins",
+            free:      resourceList("4", "4Gi"),
+            requests:  resourceList("500m", "1Gi"),
+            wantCount: 4,
+        },
+        {
+            name:       "insufficient memory",
+            free:       resourceList("4", "512Mi"),
+            requests:   resourceList("500m", "1Gi"),
+            wantCount:  0,
+            wantReason: "insufficient memory (requests 1Gi, 512Mi free)",
+        },
+        {
+            name: "no pod slots left",
+            free: corev1.ResourceList{
+                corev1.ResourceCPU:  resource.MustParse("4"),
+                corev1.ResourcePods: resource.MustParse("0"),
+            },
+            requests: corev1.ResourceList{
+                corev1.ResourceCPU:  resource.MustParse("100m"),
+                corev1.ResourcePods: resource.MustParse("1"),
+            },
+            wantCount:  0,
+            wantReason: "insufficient pods (requests 1, 0 free)",
+        },
+        {
+            name:       "overcommitted node counts as nothing free",
+            free:       resourceList("-1", "4Gi"),
+            requests:   resourceList("100m", "1Gi"),
+            wantCount:  0,
+            wantReason: "insufficient cpu (requests 100m, -1 free)",
+        },
+        {
+            name:      "zero requests are skipped",
+            free:      resourceList("1", "0"),
+            requests:  resourceList("250m", "0"),
+            wantCount: 4,
+        },
+        {
+            name:      "nothing requested fits without limit",
+            free:      resourceList("1", "1Gi"),
+            requests:  resourceList("0", ""),
+            wantCount: math.MaxInt64,
+        },
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            count, reason := fitCount(test.free, test.requests)
+            if count != test.wantCount || reason != test.wantReason {
+                t.Errorf("got (%d, %q), want (%d, %q)", count, reason, test.wantCount, test.wantReason)
+            }
+        })
+    }
+}
+
+func TestCheckConstraints(t *testing.T) {
+    cordoned := testNode("cordoned", "4", "8Gi", 110)
+    cordoned.Spec.Unschedulable = true
+
+    gpu := testNode("gpu", "4", "8Gi", 110)
+    gpu.Labels["accelerator"] = "nvidia"
+    gpu.Spec.Taints = []corev1.Taint{{Key: "nvidia.com/gpu", Value: "present", Effect: corev1.TaintEffectNoSchedule}}
+
+    draining := testNode("draining", "4", "8Gi", 110)
+    draining.Spec.Taints = []corev1.Taint{{Key: "example.com/drain", Effect: corev1.TaintEffectNoExecute}}
+
+    preferred := testNode("preferred", "4", "8Gi", 110)
+    preferred.Spec.Taints = []corev1.Taint{{Key: "example.com/spot", Effect: corev1.TaintEffectPreferNoSchedule}}
+
+    plain := testNode("plain", "4", "8Gi", 110)
+
+    gpuToleration := []corev1.Toleration{{Key: "nvidia.com/gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}}
+    gpuAffinity := &corev1.Affinity{
+        NodeAffinity: &corev1.NodeAffinity{
+            RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+                NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+                    MatchExpressions: []corev1.NodeSelectorRequirement{{
+                        Key:      "accelerator",
+                        Operator: corev1.NodeSelectorOpIn,
+                        Values:   []string{"nvidia"},
+                    }},
+                }},
+            },
+        },
+    }
+
+    tests := []struct {
+        name string
+        node corev1.Node
+        spec func(*corev1.PodSpec)
+        want string
+    }{
+        {
+            name: "plain node",
+            node: plain,
+            want: "",
+        },
+        {
+            name: "cordoned node",
+            node: cordoned,
+            want: "node is cordoned",
+        },
+        {
+            name: "cordoned node tolerated",
+            node: cordoned,
+            spec: func(spec *corev1.PodSpec) {
+                spec.Tolerations = []corev1.Toleration{{Key: corev1.TaintNodeUnschedulable, Operator: corev1.TolerationOpExists}}
+            },
+            want: "",
+        },
+        {
+            name: "node selector mismatch",
+            node: plain,
+            spec: func(spec *corev1.PodSpec) {
+                spec.NodeSelector = map[string]string{"accelerator": "nvidia"}
+            },
+            want: "node does not match the pod's node selector or affinity",
+        },
+        {
+            name: "required affinity mismatch",
+            node: plain,
+            spec: func(spec *corev1.PodSpec) {
+                spec.Affinity = gpuAffinity
+            },
+            want: "node does not match the pod's node selector or affinity",
+        },
+        {
+            name: "untolerated NoSchedule taint",
+            node: gpu,
+            spec: func(spec *corev1.PodSpec) {
+                spec.Affinity = gpuAffinity
+            },
+            want: "untolerated taint nvidia.com/gpu=present:NoSchedule",
+        },
+        {
+            name: "tolerated NoSchedule taint",
+            node: gpu,
+            spec: func(spec *corev1.PodSpec) {
+                spec.Affinity = gpuAffinity
+                spec.Tolerations = gpuToleration
+            },
+            want: "",
+        },
+        {
+            name: "untolerated NoExecute taint",
+            node: draining,
+            spec: func(spec *corev1.PodSpec) {
+                spec.Tolerations = gpuToleration
+            },
+            want: "untolerated taint example.com/drain:NoExecute",
+        },
+        {
+            name: "PreferNoSchedule taint does not block",
+            node: preferred,
+            want: "",
+        },
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            pod := testPod("default", "web", "", "100m", "128Mi")
+            if test.spec != nil {
+                test.spec(&pod.Spec)
+            }
+            if got := checkConstraints(&pod, &test.node); got != test.want {
+                t.Errorf("got %q, want %q", got, test.want)
+            }
+        })
+    }
+}
+
+func TestNodeStatesCountPodSlots(t *testing.T) {
+    nodes := []corev1.Node{testNode("small", "4", "8Gi", 2)}
+    pods := []corev1.Pod{
+        testPod("default", "a", "small", "100m", "128Mi"),
+        testPod("default", "b", "small", "100m", "128Mi"),
+    }
+    states := newNodeStates(nodes, podsByNode(pods), basisAllocatable)
+    pod := testPod("default", "c", "", "100m", "128Mi")
+
+    count, reason := fitCount(states[0].Free, placementRequests(&pod))
+    if count != 0 || reason != "insufficient pods (requests 1, 0 free)" {
+        t.Errorf("got (%d, %q), want the node to be out of pod slots", count, reason)
+    }
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strings"
+    "text/tabwriter"
+    "time"
+)
+
+// Snapshot is a node report saved with --save for a later diff. Labels holds
+// the node labels by node name, since NodeAllocation does not serialize
+// them, so that snapshots can be grouped with --group-by.
+type Snapshot struct {
+    Timestamp time.Time                    `json:"timestamp" yaml:"timestamp"`
+    Basis     string                       `json:"basis" yaml:"basis"`
+    Nodes     []NodeAllocation             `json:"nodes" yaml:"nodes"`
+    Labels    map[string]map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// Values of AllocationDelta.Status.
+const (
+    deltaAdded     = "added"
+    deltaRemoved   = "removed"
+    deltaChanged   = "changed"
+    deltaUnchanged = "unchanged"
+)
+
+// AllocationDelta is the change of a node, a group of nodes or the cluster
+// between two snapshots. Nodes that only exist in one snapshot count as
+// going from or to zero.
+type AllocationDelta struct {
+    Name              string            `json:"name" yaml:"name"`
+    Labels            map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+    Status            string            `json:"status" yaml:"status"`
+    NodeCount         int               `json:"node_count,omitempty" yaml:"node_count,omitempty"`
+    DeployedPodCount  int64             `json:"deployed_pod_count" yaml:"deployed_pod_count"`
+    AvailablePodSlots int64             `json:"available_pod_slots" yaml:"available_pod_slots"`
+    CPUAllocated      float64           `json:"cpu_allocated" yaml:"cpu_allocated"`
+    CPUAvailable      float64           `json:"cpu_available" yaml:"cpu_available"`
+    RAMAllocated      float64           `json:"ram_allocated" yaml:"ram_allocated"`
+    RAMAvailable      float64           `json:"ram_available" yaml:"ram_available"`
+}
+
+// DiffReport is the output of the diff command. Groups is only set with
+// --group-by.
+type DiffReport struct {
+    Before  time.Time         `json:"before" yaml:"before"`
+    After   time.Time         `json:"after" yaml:"after"`
+    GroupBy []string          `json:"group_by,omitempty" yaml:"group_by,omitempty"`
+    Nodes   []AllocationDelta `json:"nodes" yaml:"nodes"`
+    Groups  []AllocationDelta `json:"groups,omitempty" yaml:"groups,omitempty"`
+    Total   AllocationDelta   `json:"total" yaml:"total"`
+}
+
+// newSnapshot records the allocations as of now.
+func newSnapshot(allocations []NodeAllocation, basis string) Snapshot {
+    snapshot := Snapshot{
+        Timestamp: time.Now().UTC(),
+        Basis:     basis,
+        Nodes:     allocations,
+        Labels:    make(map[string]map[string]string, len(allocations)),
+    }
+    for _, alloc := range allocations {
+        snapshot.Labels[alloc.NodeName] = alloc.Labels
+    }
+    return snapshot
+}
+
+func saveSnapshot(path string, snapshot Snapshot) error {
+    data, err := json.MarshalIndent(snapshot, "", "  ")
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// readSnapshot loads a snapshot saved with --save and restores the node
+// labels.
+func readSnapshot(path string) (Snapshot, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return Snapshot{}, err
+    }
+    var snapshot Snapshot
+    if err := json.Unmarshal(data, &snapshot); err != nil {
+        return Snapshot{}, fmt.Errorf("%s: %w", path, err)
+    }
+    for i := range snapshot.Nodes {
+        snapshot.Nodes[i].Labels = snapshot.Labels[snapshot.Nodes[i].NodeName]
+    }
+    return snapshot, nil
+}
+
+func runDiff(args []string) {
+    fs := flag.NewFlagSet("diff", flag.ExitOnError)
+    kubeconfig := fs.String("kubeconfig", "", "absolute path to the kubeconfig file")
+    contextName := fs.String("context", "", "name of the kubeconfig context to use")
+    outputFormat := fs.String("output", "table", "output format: table, json, yaml (use -o for short form)")
+    noHeaders := fs.Bool("no-headers", false, "if true, omit header row in output")
+    selector := fs.String("selector", "", "label selector to filter nodes when comparing against the cluster")
+    includeTerminated := fs.Bool("include-terminated", false, "if true, count Succeeded and Failed pods when comparing against the cluster")
+    groupByLabels := fs.String("group-by", "", "comma separated list of node labels to sum nodes by, e.g. topology.kubernetes.io/zone")
+    nodesFile := fs.String("nodes-file", "", "compare against nodes read from this JSON/YAML file or directory instead of the API server")
+    podsFile := fs.String("pods-file", "", "compare against pods read from this JSON/YAML file or directory instead of the API server")
+
+    // Short flags
+    outputFlag := fs.String("o", "table", "output format: table, json, yaml")
+    selectorFlag := fs.String("l", "", "label selector to filter nodes when comparing against the cluster")
+
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kubectl pod-capacity diff [flags] <before.json> [<after.json>]\n\n")
+        fmt.Fprintf(os.Stderr, "This command compares two snapshots saved with --save, or a snapshot with the current state of the cluster, and shows the change in pods, CPU and RAM per node\n\n")
+        fmt.Fprintf(os.Stderr, "Flags:\n")
+        fmt.Fprintf(os.Stderr, "  -o, --output string      output format: table, json, yaml\n")
+        fmt.Fprintf(os.Stderr, "  --kubeconfig string      absolute path to the kubeconfig file\n")
+        fmt.Fprintf(os.Stderr, "  --context string         name of the kubeconfig context to use\n")
+        fmt.Fprintf(os.Stderr, "  --no-headers             if true, omit header row in output\n")
+        fmt.Fprintf(os.Stderr, "  -l, --selector string    label selector to filter nodes when comparing against the cluster\n")
+        fmt.Fprintf(os.Stderr, "  --include-terminated     if true, count Succeeded and Failed pods when comparing against the cluster\n")
+        fmt.Fprintf(os.Stderr, "  --group-by string        comma separated list of node labels to sum nodes by, e.g. topology.kubernetes.io/zone\n")
+        fmt.Fprintf(os.Stderr, "  --nodes-file string      compare against nodes read from this JSON/YAML file or directory instead of the API server\n")
+        fmt.Fprintf(os.Stderr, "  --pods-file string       compare against pods read from this JSON/YAML file or directory instead of the API server\n")
+    }
+
+    fs.Parse(args)
+
+    if *outputFlag != "table" {
+        *outputFormat = *outputFlag
+    }
+    if *selectorFlag != "" {
+        *selector = *selectorFlag
+    }
+    if fs.NArg() < 1 || fs.NArg() > 2 {
+        fs.Usage()
+        os.Exit(1)
+    }
+
+    before, err := readSnapshot(fs.Arg(0))
+    if err != nil {
+        fmt.Printf("Error reading snapshot: %s\n", err.Error())
+        os.Exit(1)
+    }
+
+    var after Snapshot
+    if fs.NArg() == 2 {
+        after, err = readSnapshot(fs.Arg(1))
+        if err != nil {
+            fmt.Printf("Error reading snapshot: %s\n", err.Error())
+            os.Exit(1)
+        }
+    } else {
+        // Compare against the cluster as it is now, using the same basis
+        // as the saved snapshot
+        source := openSource(*kubeconfig, *contextName, *nodesFile, *podsFile)
+        nodes, err := source.Nodes(*selector)
+        if err != nil {
+            fmt.Printf("Error fetching nodes: %s\n", err.Error())
+            os.Exit(1)
+        }
+        pods, err := source.Pods()
+        if err != nil {
+            fmt.Printf("Error fetching pods: %s\n", err.Error())
+            os.Exit(1)
+        }
+        opts := reportOptions{Basis: before.Basis, IncludeTerminated: *includeTerminated}
+        after = newSnapshot(buildAllocations(nodes, podsByNode(pods), nil, opts), before.Basis)
+    }
+
+    report := diffSnapshots(before, after, parseGroupBy(*groupByLabels))
+
+    switch *outputFormat {
+    case "json":
+        outputJSON(report)
+    case "yaml":
+        outputYAML(report)
+    case "table":
+        writeDiffTable(os.Stdout, report, *noHeaders)
+    default:
+        fmt.Println("Invalid output format. Supported formats: table, json, yaml.")
+        os.Exit(1)
+    }
+}
+
+// diffSnapshots compares every node, and with groupBy every group, of two
+// snapshots. Nodes and groups are ordered by name.
+func diffSnapshots(before, after Snapshot, groupBy []string) DiffReport {
+    report := DiffReport{Before: before.Timestamp, After: after.Timestamp, GroupBy: groupBy}
+    report.Nodes = diffAllocations(before.Nodes, after.Nodes)
+    report.Total = diffAllocation("TOTAL", sumAllocations("TOTAL", before.Nodes, before.Basis), sumAllocations("TOTAL", after.Nodes, after.Basis), true, true)
+    report.Total.NodeCount = len(after.Nodes) - len(before.Nodes)
+    if report.Total.NodeCount != 0 {
+        report.Total.Status = deltaChanged
+    }
+
+    if len(groupBy) > 0 {
+        beforeGroups := groupAllocations(before.Nodes, groupBy, before.Basis)
+        afterGroups := groupAllocations(after.Nodes, groupBy, after.Basis)
+        beforeByName := make(map[string]GroupAllocation)
+        for _, group := range beforeGroups.Groups {
+            beforeByName[group.Allocation.NodeName] = group
+        }
+        afterByName := make(map[string]GroupAllocation)
+        for _, group := range afterGroups.Groups {
+            afterByName[group.Allocation.NodeName] = group
+        }
+        for _, name := range unionKeys(beforeByName, afterByName) {
+            b, inBefore := beforeByName[name]
+            a, inAfter := afterByName[name]
+            delta := diffAllocation(name, b.Allocation, a.Allocation, inBefore, inAfter)
+            delta.Labels = a.Labels
+            if !inAfter {
+                delta.Labels = b.Labels
+            }
+            delta.NodeCount = a.NodeCount - b.NodeCount
+            if delta.NodeCount != 0 && delta.Status == deltaUnchanged {
+                delta.Status = deltaChanged
+            }
+            report.Groups = append(report.Groups, delta)
+        }
+    }
+    return report
+}
+
+// diffAllocations pairs up the nodes of two snapshots by name.
+func diffAllocations(before, after []NodeAllocation) []AllocationDelta {
+    beforeByName := make(map[string]NodeAllocation, len(before))
+    for _, alloc := range before {
+        beforeByName[alloc.NodeName] = alloc
+    }
+    afterByName := make(map[string]NodeAllocation, len(after))
+    for _, alloc := range after {
+        afterByName[alloc.NodeName] = alloc
+    }
+    var deltas []AllocationDelta
+    for _, name := range unionKeys(beforeByName, afterByName) {
+        b, inBefore := beforeByName[name]
+        a, inAfter := afterByName[name]
+        deltas = append(deltas, diffAllocation(name, b, a, inBefore, inAfter))
+    }
+    return deltas
+}
+
+// diffAllocation subtracts before from after. A missing side is a zero
+// allocation, so an added node's delta is its whole allocation and a
+// removed node's delta is the negation of it.
+func diffAllocation(name string, before, after NodeAllocation, inBefore, inAfter bool) AllocationDelta {
+    delta := AllocationDelta{
+        Name:              name,
+        DeployedPodCount:  after.DeployedPodCount - before.DeployedPodCount,
+        AvailablePodSlots: after.AvailablePodSlots - before.AvailablePodSlots,
+        CPUAllocated:      after.CPUAllocated - before.CPUAllocated,
+        CPUAvailable:      after.CPUAvailable - before.CPUAvailable,
+        RAMAllocated:      after.RAMAllocated - before.RAMAllocated,
+        RAMAvailable:      after.RAMAvailable - before.RAMAvailable,
+    }
+    switch {
+    case !inBefore:
+        delta.Status = deltaAdded
+    case !inAfter:
+        delta.Status = deltaRemoved
+    case delta.DeployedPodCount != 0 || delta.AvailablePodSlots != 0 ||
+        !nearlyZero(delta.CPUAllocated) || !nearlyZero(delta.CPUAvailable) ||
+        !nearlyZero(delta.RAMAllocated) || !nearlyZero(delta.RAMAvailable):
+        delta.Status = deltaChanged
+    default:
+        delta.Status = deltaUnchanged
+    }
+    return delta
+}
+
+// nearlyZero reports whether a float delta would print as zero, so that
+// rounding noise is not reported as a change.
+func nearlyZero(value float64) bool {
+    return value > -0.005 && value < 0.005
+}
+
+// unionKeys returns the keys of both maps, sorted.
+func unionKeys[V any](a, b map[string]V) []string {
+    var keys []string
+    for key := range a {
+        keys = append(keys, key)
+    }
+    for key := range b {
+        if _, ok := a[key]; !ok {
+            keys = append(keys, key)
+        }
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// writeDiffTable writes the diff as a table of signed deltas, one row per
+// group with --group-by and one row per node otherwise, ending with the
+// cluster-wide total.
+func writeDiffTable(out io.Writer, report DiffReport, noHeaders bool) {
+    fmt.Fprintf(out, "Comparing %s with %s\n\n", report.Before.Format(time.RFC3339), report.After.Format(time.RFC3339))
+    w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+    rows := report.Nodes
+    first := "NODE_NAME"
+    if len(report.GroupBy) > 0 {
+        rows = report.Groups
+        first = strings.ToUpper(strings.Join(report.GroupBy, ","))
+    }
+    if !noHeaders {
+        fmt.Fprintf(w, "%s\tSTATUS\tNODES\tDEPLOYED PODS\tAVAILABLE POD SLOTS\tCPU ALLOCATED (Cores)\tCPU AVAILABLE (Cores)\tRAM ALLOCATED (GB)\tRAM AVAILABLE (GB)\n", first)
+    }
+    printRow := func(delta AllocationDelta) {
+        nodes := "-"
+        if len(report.GroupBy) > 0 || delta.Name == "TOTAL" {
+            nodes = fmt.Sprintf("%+d", delta.NodeCount)
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%+d\t%+d\t%+.2f\t%+.2f\t%+.2f\t%+.2f\n",
+            delta.Name, delta.Status, nodes,
+            delta.DeployedPodCount, delta.AvailablePodSlots,
+            delta.CPUAllocated, delta.CPUAvailable, delta.RAMAllocated, delta.RAMAvailable)
+    }
+    for _, delta := range rows {
+        printRow(delta)
+    }
+    printRow(report.Total)
+    w.Flush()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+    "math"
+    "testing"
+    "time"
+)
+
+const zoneLabel = "topology.kubernetes.io/zone"
+
+// snapshotNode returns a node allocation as read back from a snapshot.
+func snapshotNode(name, zone string, pods, podSlots int64, cpuAllocated, cpuAvailable, ramAllocated, ramAvailable float64) NodeAllocation {
+    return NodeAllocation{
+        NodeName:          name,
+        Labels:            map[string]string{zoneLabel: zone},
+        DeployedPodCount:  pods,
+        AvailablePodSlots: podSlots,
+        CPUAllocated:      cpuAllocated,
+        CPUAvailable:      cpuAvailable,
+        RAMAllocated:      ramAllocated,
+        RAMAvailable:      ramAvailable,
+    }
+}
+
+// assertDelta compares two deltas, allowing for float rounding.
+func assertDelta(t *testing.T, got, want AllocationDelta) {
+    t.Helper()
+    floatsMatch := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+    if got.Name != want.Name || got.Status != want.Status || got.NodeCount != want.NodeCount ||
+        got.DeployedPodCount != want.DeployedPodCount || got.AvailablePodSlots != want.AvailablePodSlots ||
+        !floatsMatch(got.CPUAllocated, want.CPUAllocated) || !floatsMatch(got.CPUAvailable, want.CPUAvailable) ||
+        !floatsMatch(got.RAMAllocated, want.RAMAllocated) || !floatsMatch(got.RAMAvailable, want.RAMAvailable) {
+        t.Errorf("got %+v, want %+v", got, want)
+    }
+    if want.Labels != nil && got.Labels[zoneLabel] != want.Labels[zoneLabel] {
+        t.Errorf("%s: got labels %v, want %v", want.Name, got.Labels, want.Labels)
+    }
+}
+
+func TestDiffSnapshots(t *testing.T) {
+    before := Snapshot{
+        Timestamp: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+        Basis:     basisAllocatable,
+        Nodes: []NodeAllocation{
+            snapshotNode("node-a", "eu-west-1a", 10, 100, 2, 2, 4, 12),
+            snapshotNode("node-b", "eu-west-1a", 5, 105, 1, 3, 2, 14),
+            snapshotNode("node-c", "eu-west-1b", 3, 107, 0.5, 3.5, 1, 15),
+        },
+    }
+    after := Snapshot{
+        Timestamp: time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC),
+        Basis:     basisAllocatable,
+        Nodes: []NodeAllocation{
+            snapshotNode("node-d", "eu-west-1c", 2, 108, 0.25, 3.75, 0.5, 15.5),
+            snapshotNode("node-b", "eu-west-1a", 5, 105, 1, 3, 2, 14),
+            snapshotNode("node-a", "eu-west-1a", 12, 98, 2.5, 1.5, 5, 11),
+        },
+    }
+
+    report := diffSnapshots(before, after, []string{zoneLabel})
+    if !report.Before.Equal(before.Timestamp) || !report.After.Equal(after.Timestamp) {
+        t.Errorf("got timestamps %s and %s", report.Before, report.After)
+    }
+
+    wantNodes := []AllocationDelta{
+        {Name: "node-a", Status: deltaChanged, DeployedPodCount: 2, AvailablePodSlots: -2, CPUAllocated: 0.5, CPUAvailable: -0.5, RAMAllocated: 1, RAMAvailable: -1},
+        {Name: "node-b", Status: deltaUnchanged},
+        {Name: "node-c", Status: deltaRemoved, DeployedPodCount: -3, AvailablePodSlots: -107, CPUAllocated: -0.5, CPUAvailable: -3.5, RAMAllocated: -1, RAMAvailable: -15},
+        {Name: "node-d", Status: deltaAdded, DeployedPodCount: 2, AvailablePodSlots: 108, CPUAllocated: 0.25, CPUAvailable: 3.75, RAMAllocated: 0.5, RAMAvailable: 15.5},
+    }
+    if len(report.Nodes) != len(wantNodes) {
+        t.Fatalf("got %d node deltas, want %d: %+v", len(report.Nodes), len(wantNodes), report.Nodes)
+    }
+    for i, want := range wantNodes {
+        assertDelta(t, report.Nodes[i], want)
+    }
+
+    wantGroups := []AllocationDelta{
+        {Name: "eu-west-1a", Labels: map[string]string{zoneLabel: "eu-west-1a"}, Status: deltaChanged, DeployedPodCount: 2, AvailablePodSlots: -2, CPUAllocated: 0.5, CPUAvailable: -0.5, RAMAllocated: 1, RAMAvailable: -1},
+        {Name: "eu-west-1b", Labels: map[string]string{zoneLabel: "eu-west-1b"}, Status: deltaRemoved, NodeCount: -1, DeployedPodCount: -3, AvailablePodSlots: -107, CPUAllocated: -0.5, CPUAvailable: -3.5, RAMAllocated: -1, RAMAvailable: -15},
+        {Name: "eu-west-1c", Labels: map[string]string{zoneLabel: "eu-west-1c"}, Status: deltaAdded, NodeCount: 1, DeployedPodCount: 2, AvailablePodSlots: 108, CPUAllocated: 0.25, CPUAvailable: 3.75, RAMAllocated: 0.5, RAMAvailable: 15.5},
+    }
+    if len(report.Groups) != len(wantGroups) {
+        t.Fatalf("got %d group deltas, want %d: %+v", len(report.Groups), len(wantGroups), report.Groups)
+    }
+    for i, want := range wantGroups {
+        assertDelta(t, report.Groups[i], want)
+    }
+
+    assertDelta(t, report.Total, AllocationDelta{
+        Name: "TOTAL", Status: deltaChanged, DeployedPodCount: 1, AvailablePodSlots: -1,
+        CPUAllocated: 0.25, CPUAvailable: -0.25, RAMAllocated: 0.5, RAMAvailable: -0.5,
+    })
+}
+
+func TestDiffSnapshotsNodeCountChange(t *testing.T) {
+    // An empty node joining changes nothing but the node count, which is
+    // still reported as a change
+    before := Snapshot{Nodes: []NodeAllocation{snapshotNode("node-a", "eu-west-1a", 1, 9, 1, 1, 1, 1)}}
+    after := Snapshot{Nodes: append(before.Nodes, snapshotNode("node-b", "eu-west-1a", 0, 0, 0, 0, 0, 0))}
+
+    report := diffSnapshots(before, after, []string{zoneLabel})
+    assertDelta(t, report.Nodes[1], AllocationDelta{Name: "node-b", Status: deltaAdded})
+    assertDelta(t, report.Groups[0], AllocationDelta{Name: "eu-west-1a", Status: deltaChanged, NodeCount: 1})
+    assertDelta(t, report.Total, AllocationDelta{Name: "TOTAL", Status: deltaChanged, NodeCount: 1})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+
+    corev1 "k8s.io/api/core/v1"
+    policyv1 "k8s.io/api/policy/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/rest"
+    metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// clusterSource provides the cluster state the reports are computed from,
+// either from a live API server or from dumped manifests.
+type clusterSource interface {
+    // Nodes returns the nodes matching the optional label selector.
+    Nodes(selector string) ([]corev1.Node, error)
+    // Node returns a single node by name.
+    Node(name string) (*corev1.Node, error)
+    // Pods returns every pod bound to a node.
+    Pods() ([]corev1.Pod, error)
+    // NodePods returns the pods bound to a single node.
+    NodePods(nodeName string) ([]corev1.Pod, error)
+    // PendingPods returns the Pending pods not bound to a node yet.
+    PendingPods() ([]corev1.Pod, error)
+    // ResourceQuotas returns the ResourceQuotas of every namespace.
+    ResourceQuotas() ([]corev1.ResourceQuota, error)
+    // PodDisruptionBudgets returns the PodDisruptionBudgets of every
+    // namespace.
+    PodDisruptionBudgets() ([]policyv1.PodDisruptionBudget, error)
+    // Usage returns the observed usage per node, attributing pod metrics
+    // to nodes through the given pods.
+    Usage(pods []corev1.Pod) (map[string]nodeUsage, error)
+}
+
+// openSource returns a fileSource if either file flag is set, and a
+// liveSource for the kubeconfig context otherwise. It exits if the files
+// cannot be read.
+func openSource(kubeconfig, contextName, nodesFile, podsFile string) clusterSource {
+    if nodesFile == "" && podsFile == "" {
+        config := buildConfig(kubeconfig, contextName)
+        return newLiveSource(config, newClientset(config))
+    }
+    source, err := newFileSource(os.Stderr, nodesFile, podsFile)
+    if err != nil {
+        fmt.Printf("Error reading files: %s\n", err.Error())
+        os.Exit(1)
+    }
+    return source
+}
+
+// liveSource reads the cluster state from the API server.
+type liveSource struct {
+    config    *rest.Config
+    clientset kubernetes.Interface
+}
+
+func newLiveSource(config *rest.Config, clientset kubernetes.Interface) *liveSource {
+    return &liveSource{config: config, clientset: clientset}
+}
+
+func (s *liveSource) Nodes(selector string) ([]corev1.Node, error) {
+    return listNodes(s.clientset, selector)
+}
+
+func (s *liveSource) Node(name string) (*corev1.Node, error) {
+    return s.clientset.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+}
+
+func (s *liveSource) Pods() ([]corev1.Pod, error) {
+    return listPods(s.clientset)
+}
+
+func (s *liveSource) NodePods(nodeName string) ([]corev1.Pod, error) {
+    return listNodePods(s.clientset, nodeName)
+}
+
+func (s *liveSource) PendingPods() ([]corev1.Pod, error) {
+    return listPendingPods(s.clientset)
+}
+
+func (s *liveSource) ResourceQuotas() ([]corev1.ResourceQuota, error) {
+    return listResourceQuotas(s.clientset)
+}
+
+func (s *liveSource) PodDisruptionBudgets() ([]policyv1.PodDisruptionBudget, error) {
+    pdbs, err := s.clientset.PolicyV1().PodDisruptionBudgets("").List(context.TODO(), metav1.ListOptions{})
+    if err != nil {
+        return nil, err
+    }
+    return pdbs.Items, nil
+}
+
+func (s *liveSource) Usage(pods []corev1.Pod) (map[string]nodeUsage, error) {
+    metricsClient, err := metricsclientset.NewForConfig(s.config)
+    if err != nil {
+        return nil, err
+    }
+    return fetchUsage(metricsClient, pods)
+}
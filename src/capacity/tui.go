@@ -0,0 +1,468 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+
+    tea "github.com/charmbracelet/bubbletea"
+    corev1 "k8s.io/api/core/v1"
+)
+
+// tuiView is one level of the interactive drill-down: the node list, the
+// pods of a node, and the pods of a workload.
+type tuiView int
+
+const (
+    viewNodes tuiView = iota
+    viewPods
+    viewWorkload
+)
+
+// barWidth is the number of cells in a utilization bar.
+const barWidth = 20
+
+// tuiNodeSortKeys are the columns the node list cycles through with s.
+var tuiNodeSortKeys = []string{"node-name", "cpu-allocated-pct", "ram-allocated-pct", "deployed-pods", "cpu-available", "ram-available"}
+
+// tuiPodSortKeys are the orders the pod lists cycle through with s.
+var tuiPodSortKeys = []string{podSortCPU, podSortRAM, podSortName}
+
+// tuiModel is the Bubble Tea model of the interactive mode. It works on the
+// snapshot of nodes and pods taken at startup.
+type tuiModel struct {
+    allocations []NodeAllocation
+    nodes       map[string]*corev1.Node
+    nodePods    map[string][]corev1.Pod
+    opts        reportOptions
+
+    nodeSorts []sortOrder
+    nodeSort  int
+    podSort   int
+    reverse   bool
+
+    view   tuiView
+    cursor [3]int
+    offset [3]int
+    height int
+
+    nodeName string
+    pods     []PodAllocation
+
+    workloadNamespace string
+    workloadKind      string
+    workloadName      string
+    workloadPods      []PodAllocation
+}
+
+// runInteractive shows the node allocations in a full screen terminal UI
+// until the user quits.
+func runInteractive(allocations []NodeAllocation, nodes []corev1.Node, nodePods map[string][]corev1.Pod, opts reportOptions) error {
+    p := tea.NewProgram(newTUIModel(allocations, nodes, nodePods, opts), tea.WithAltScreen())
+    _, err := p.Run()
+    return err
+}
+
+// newTUIModel sorts the node list by the --sort-by column, which is added to
+// the columns s cycles through if it is not one of them already.
+func newTUIModel(allocations []NodeAllocation, nodes []corev1.Node, nodePods map[string][]corev1.Pod, opts reportOptions) tuiModel {
+    m := tuiModel{
+        allocations: allocations,
+        nodes:       make(map[string]*corev1.Node, len(nodes)),
+        nodePods:    nodePods,
+        opts:        opts,
+    }
+    for i := range nodes {
+        m.nodes[nodes[i].Name] = &nodes[i]
+    }
+    for _, key := range tuiNodeSortKeys {
+        order, _ := parseSortBy(key, nil)
+        m.nodeSorts = append(m.nodeSorts, *order)
+    }
+    if opts.Order != nil {
+        m.nodeSort = -1
+        for i, order := range m.nodeSorts {
+            if order.Column.Key == opts.Order.Column.Key {
+                m.nodeSort = i
+            }
+        }
+        if m.nodeSort == -1 {
+            m.nodeSorts = append(m.nodeSorts, sortOrder{Column: opts.Order.Column})
+            m.nodeSort = len(m.nodeSorts) - 1
+        }
+        m.reverse = opts.Order.Descending
+    }
+    m.sortNodes()
+    return m
+}
+
+func (m tuiModel) Init() tea.Cmd {
+    return nil
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+    switch msg := msg.(type) {
+    case tea.WindowSizeMsg:
+        m.height = msg.Height
+    case tea.KeyMsg:
+        switch msg.String() {
+        case "q", "ctrl+c":
+            return m, tea.Quit
+        case "up", "k":
+            m.moveCursor(-1)
+        case "down", "j":
+            m.moveCursor(1)
+        case "pgup":
+            m.moveCursor(-m.bodyHeight())
+        case "pgdown":
+            m.moveCursor(m.bodyHeight())
+        case "home", "g":
+            m.cursor[m.view] = 0
+        case "end", "G":
+            m.moveCursor(m.rowCount())
+        case "s":
+            m.cycleSort()
+        case "r":
+            m.reverse = !m.reverse
+            m.resort()
+        case "enter", "right", "l":
+            m.drillDown()
+        case "esc", "backspace", "left", "h":
+            if m.view > viewNodes {
+                m.view--
+            }
+        }
+    }
+    m.scroll()
+    return m, nil
+}
+
+func (m tuiModel) View() string {
+    header, body, _, _ := m.render()
+    if m.height > 0 {
+        end := m.offset[m.view] + m.bodyHeight()
+        if end > len(body) {
+            end = len(body)
+        }
+        body = body[m.offset[m.view]:end]
+    }
+
+    var s strings.Builder
+    for _, line := range header {
+        s.WriteString(line + "\n")
+    }
+    for _, line := range body {
+        s.WriteString(line + "\n")
+    }
+    s.WriteString("\n" + m.help())
+    return s.String()
+}
+
+// moveCursor moves the cursor of the current view by delta rows, stopping
+// at the first and last row.
+func (m *tuiModel) moveCursor(delta int) {
+    cursor := m.cursor[m.view] + delta
+    if cursor > m.rowCount()-1 {
+        cursor = m.rowCount() - 1
+    }
+    if cursor < 0 {
+        cursor = 0
+    }
+    m.cursor[m.view] = cursor
+}
+
+// rowCount is the number of selectable rows in the current view.
+func (m *tuiModel) rowCount() int {
+    switch m.view {
+    case viewPods:
+        return len(m.pods)
+    case viewWorkload:
+        return len(m.workloadPods)
+    }
+    return len(m.allocations)
+}
+
+// cycleSort switches the current view to the next sort order.
+func (m *tuiModel) cycleSort() {
+    if m.view == viewNodes {
+        m.nodeSort = (m.nodeSort + 1) % len(m.nodeSorts)
+    } else {
+        m.podSort = (m.podSort + 1) % len(tuiPodSortKeys)
+    }
+    m.resort()
+}
+
+// resort sorts every list with the current orders. The cursors stay on the
+// same row number rather than following the selected item.
+func (m *tuiModel) resort() {
+    m.sortNodes()
+    sortPodAllocations(m.pods, tuiPodSortKeys[m.podSort], m.reverse)
+    sortPodAllocations(m.workloadPods, tuiPodSortKeys[m.podSort], m.reverse)
+}
+
+func (m *tuiModel) sortNodes() {
+    order := m.nodeSorts[m.nodeSort]
+    order.Descending = m.reverse
+    sortAllocations(m.allocations, &order)
+}
+
+// drillDown opens the pods of the node under the cursor, or the workload of
+// the pod under the cursor.
+func (m *tuiModel) drillDown() {
+    switch m.view {
+    case viewNodes:
+        if len(m.allocations) == 0 {
+            return
+        }
+        m.nodeName = m.allocations[m.cursor[viewNodes]].NodeName
+        m.pods = nodePodAllocations(m.nodePods[m.nodeName], m.nodes[m.nodeName], m.opts)
+        sortPodAllocations(m.pods, tuiPodSortKeys[m.podSort], m.reverse)
+    case viewPods:
+        if len(m.pods) == 0 {
+            return
+        }
+        pod := m.pods[m.cursor[viewPods]]
+        m.workloadNamespace = pod.Namespace
+        m.workloadKind = pod.OwnerKind
+        m.workloadName = pod.OwnerName
+        m.workloadPods = nil
+        if pod.OwnerKind == "" {
+            // A bare pod is its own workload.
+            m.workloadKind = "Pod"
+            m.workloadName = pod.Name
+            m.workloadPods = []PodAllocation{pod}
+        } else {
+            m.workloadPods = m.findWorkloadPods(pod.Namespace, pod.OwnerKind, pod.OwnerName)
+        }
+        sortPodAllocations(m.workloadPods, tuiPodSortKeys[m.podSort], m.reverse)
+    default:
+        return
+    }
+    m.view++
+    m.cursor[m.view] = 0
+    m.offset[m.view] = 0
+}
+
+// findWorkloadPods returns the pods of a workload across every node.
+func (m *tuiModel) findWorkloadPods(namespace, kind, name string) []PodAllocation {
+    var pods []PodAllocation
+    for nodeName, nodePods := range m.nodePods {
+        for _, alloc := range nodePodAllocations(nodePods, m.nodes[nodeName], m.opts) {
+            if alloc.Namespace == namespace && alloc.OwnerKind == kind && alloc.OwnerName == name {
+                pods = append(pods, alloc)
+            }
+        }
+    }
+    return pods
+}
+
+// bodyHeight is the number of body lines that fit on the screen below the
+// header and above the help line.
+func (m *tuiModel) bodyHeight() int {
+    header, _, _, _ := m.render()
+    height := m.height - len(header) - 2
+    if height < 1 {
+        height = 1
+    }
+    return height
+}
+
+// scroll adjusts the offset of the current view as little as possible to
+// keep the lines of the row under the cursor on screen.
+func (m *tuiModel) scroll() {
+    if m.height == 0 {
+        return
+    }
+    _, body, cursorStart, cursorEnd := m.render()
+    height := m.bodyHeight()
+    offset := m.offset[m.view]
+    if cursorEnd >= offset+height {
+        offset = cursorEnd - height + 1
+    }
+    if cursorStart < offset {
+        offset = cursorStart
+    }
+    if offset > len(body)-height {
+        offset = len(body) - height
+    }
+    if offset < 0 {
+        offset = 0
+    }
+    m.offset[m.view] = offset
+}
+
+// render returns the header and body lines of the current view, and the
+// first and last body line of the row under the cursor.
+func (m *tuiModel) render() ([]string, []string, int, int) {
+    switch m.view {
+    case viewPods:
+        return m.renderPods()
+    case viewWorkload:
+        return m.renderWorkload()
+    }
+    return m.renderNodes()
+}
+
+func (m *tuiModel) renderNodes() ([]string, []string, int, int) {
+    order := m.nodeSorts[m.nodeSort]
+    header := []string{
+        fmt.Sprintf("Nodes: %d, sorted by %s%s", len(m.allocations), order.Column.Key, directionSuffix(m.reverse)),
+        "",
+        fmt.Sprintf("  %-30s %-27s  %-27s  %s", "NODE", "CPU ALLOCATED", "RAM ALLOCATED", "PODS"),
+    }
+    var body []string
+    for i, alloc := range m.allocations {
+        body = append(body, fmt.Sprintf("%s %-30s %s %5.1f%%  %s %5.1f%%  %d/%d",
+            cursorMark(i == m.cursor[viewNodes]),
+            truncate(alloc.NodeName, 30),
+            utilizationBar(alloc.CPUAllocatedPct), alloc.CPUAllocatedPct,
+            utilizationBar(alloc.RAMAllocatedPct), alloc.RAMAllocatedPct,
+            alloc.DeployedPodCount, alloc.PodAllocatable))
+    }
+    return header, body, m.cursor[viewNodes], m.cursor[viewNodes]
+}
+
+func (m *tuiModel) renderPods() ([]string, []string, int, int) {
+    var alloc NodeAllocation
+    for _, a := range m.allocations {
+        if a.NodeName == m.nodeName {
+            alloc = a
+        }
+    }
+    header := []string{
+        fmt.Sprintf("Node %s: CPU %.2f/%.2f cores (%.1f%%), RAM %.2f/%.2f GB (%.1f%%), %d pods, sorted by %s%s",
+            m.nodeName,
+            alloc.CPUAllocated, alloc.CPUAllocated+alloc.CPUAvailable, alloc.CPUAllocatedPct,
+            alloc.RAMAllocated, alloc.RAMAllocated+alloc.RAMAvailable, alloc.RAMAllocatedPct,
+            len(m.pods), tuiPodSortKeys[m.podSort], directionSuffix(m.reverse)),
+        "",
+        podTableHeader("WORKLOAD", "CPU %", "RAM %"),
+    }
+    var body []string
+    cursorStart, cursorEnd := 0, 0
+    for i, pod := range m.pods {
+        selected := i == m.cursor[viewPods]
+        if selected {
+            cursorStart = len(body)
+        }
+        workload := "-"
+        if pod.OwnerKind != "" {
+            workload = pod.OwnerKind + "/" + pod.OwnerName
+        }
+        body = append(body, podTableRow(selected, pod.Namespace+"/"+pod.Name, workload, pod,
+            fmt.Sprintf("%.1f", pod.CPUSharePct), fmt.Sprintf("%.1f", pod.RAMSharePct)))
+        body = append(body, containerRows(pod)...)
+        if selected {
+            cursorEnd = len(body) - 1
+        }
+    }
+    return header, body, cursorStart, cursorEnd
+}
+
+func (m *tuiModel) renderWorkload() ([]string, []string, int, int) {
+    var cpuRequests, cpuLimits, ramRequests, ramLimits float64
+    for _, pod := range m.workloadPods {
+        cpuRequests += pod.CPURequests
+        cpuLimits += pod.CPULimits
+        ramRequests += pod.RAMRequests
+        ramLimits += pod.RAMLimits
+    }
+    header := []string{
+        fmt.Sprintf("%s %s/%s: %d pods, CPU requests %.2f cores (limits %.2f), RAM requests %.2f GB (limits %.2f), sorted by %s%s",
+            m.workloadKind, m.workloadNamespace, m.workloadName, len(m.workloadPods),
+            cpuRequests, cpuLimits, ramRequests, ramLimits,
+            tuiPodSortKeys[m.podSort], directionSuffix(m.reverse)),
+        "",
+        podTableHeader("NODE", "QOS", "PRIORITY"),
+    }
+    var body []string
+    cursorStart, cursorEnd := 0, 0
+    for i, pod := range m.workloadPods {
+        selected := i == m.cursor[viewWorkload]
+        if selected {
+            cursorStart = len(body)
+        }
+        priority := pod.PriorityClass
+        if priority == "" {
+            priority = "-"
+        }
+        body = append(body, podTableRow(selected, pod.Name, pod.NodeName, pod, pod.QOSClass, priority))
+        body = append(body, containerRows(pod)...)
+        if selected {
+            cursorEnd = len(body) - 1
+        }
+    }
+    return header, body, cursorStart, cursorEnd
+}
+
+// podTableHeader and podTableRow lay out the pod lists: the pod, a second
+// text column, the requests and limits, and two short extra columns.
+func podTableHeader(second, extra1, extra2 string) string {
+    return fmt.Sprintf("  %-50s %-35s %8s %8s %8s %8s %-10s %s", "POD", second, "CPU REQ", "CPU LIM", "RAM REQ", "RAM LIM", extra1, extra2)
+}
+
+func podTableRow(selected bool, name, second string, pod PodAllocation, extra1, extra2 string) string {
+    return fmt.Sprintf("%s %-50s %-35s %8.2f %8.2f %8.2f %8.2f %-10s %s",
+        cursorMark(selected), truncate(name, 50), truncate(second, 35),
+        pod.CPURequests, pod.CPULimits, pod.RAMRequests, pod.RAMLimits, extra1, extra2)
+}
+
+// containerRows lists the requests and limits of every container of a pod
+// below the pod's row.
+func containerRows(pod PodAllocation) []string {
+    var rows []string
+    for _, container := range pod.Containers {
+        name := container.Name
+        if container.Init {
+            name += " (init)"
+        }
+        rows = append(rows, fmt.Sprintf("    └ %-46s %-35s %8.2f %8.2f %8.2f %8.2f",
+            truncate(name, 46), "",
+            container.CPURequest, container.CPULimit, container.RAMRequest, container.RAMLimit))
+    }
+    return rows
+}
+
+func (m *tuiModel) help() string {
+    switch m.view {
+    case viewPods:
+        return "up/down: move  enter: show workload  s: sort  r: reverse  esc: back to nodes  q: quit"
+    case viewWorkload:
+        return "up/down: move  s: sort  r: reverse  esc: back to pods  q: quit"
+    }
+    return "up/down: move  enter: show pods  s: sort  r: reverse  q: quit"
+}
+
+// utilizationBar draws pct as a bar of barWidth cells, capped at 100%.
+func utilizationBar(pct float64) string {
+    filled := int(pct/100*barWidth + 0.5)
+    if filled > barWidth {
+        filled = barWidth
+    }
+    if filled < 0 {
+        filled = 0
+    }
+    return strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled)
+}
+
+func cursorMark(selected bool) string {
+    if selected {
+        return ">"
+    }
+    return " "
+}
+
+func directionSuffix(reverse bool) string {
+    if reverse {
+        return " (reversed)"
+    }
+    return ""
+}
+
+// truncate shortens s to at most n runes, marking the cut with ~.
+func truncate(s string, n int) string {
+    runes := []rune(s)
+    if len(runes) <= n {
+        return s
+    }
+    return string(runes[:n-1]) + "~"
+}
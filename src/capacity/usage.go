@@ -0,0 +1,112 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io"
+
+    corev1 "k8s.io/api/core/v1"
+    metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// nodeUsage holds the observed resource usage of a node as reported by
+// metrics-server, both for the node as a whole and summed over its pods.
+type nodeUsage struct {
+    CPUUsage    int64 // millicores
+    RAMUsage    int64 // bytes
+    PodCPUUsage int64 // millicores
+    PodRAMUsage int64 // bytes
+}
+
+// fetchUsage queries the metrics.k8s.io API for node and pod metrics and
+// returns the usage per node. Pod metrics are attributed to nodes through
+// the given pods, since PodMetrics do not carry the node name.
+func fetchUsage(metricsClient metricsclientset.Interface, pods []corev1.Pod) (map[string]nodeUsage, error) {
+    nodeMetrics, err := metricsClient.MetricsV1beta1().NodeMetricses().List(context.TODO(), metav1.ListOptions{})
+    if err != nil {
+        return nil, err
+    }
+    podMetrics, err := metricsClient.MetricsV1beta1().PodMetricses("").List(context.TODO(), metav1.ListOptions{})
+    if err != nil {
+        return nil, err
+    }
+
+    usage := make(map[string]nodeUsage)
+    for _, metrics := range nodeMetrics.Items {
+        u := usage[metrics.Name]
+        u.CPUUsage = metrics.Usage.Cpu().MilliValue()
+        u.RAMUsage = metrics.Usage.Memory().Value()
+        usage[metrics.Name] = u
+    }
+
+    podNodes := make(map[string]string, len(pods))
+    for _, pod := range pods {
+        podNodes[pod.Namespace+"/"+pod.Name] = pod.Spec.NodeName
+    }
+    for _, metrics := range podMetrics.Items {
+        nodeName, ok := podNodes[metrics.Namespace+"/"+metrics.Name]
+        if !ok {
+            continue
+        }
+        u := usage[nodeName]
+        for _, container := range metrics.Containers {
+            u.PodCPUUsage += container.Usage.Cpu().MilliValue()
+            u.PodRAMUsage += container.Usage.Memory().Value()
+        }
+        usage[nodeName] = u
+    }
+    return usage, nil
+}
+
+// usageOrWarn returns the observed usage per node from source. If the
+// metrics API can't be queried it writes a warning to warnings and returns
+// nil, so that the report can carry on without usage.
+func usageOrWarn(source clusterSource, pods []corev1.Pod, warnings io.Writer) map[string]nodeUsage {
+    usage, err := source.Usage(pods)
+    if err != nil {
+        fmt.Fprintf(warnings, "Warning: usage data unavailable, is metrics-server installed? %s\n", err.Error())
+        return nil
+    }
+    return usage
+}
+
+// applyUsage adds the observed usage of a node to its allocation, along with
+// usage as a percentage of the pods' requests and of the node's allocatable
+// resources.
+func applyUsage(alloc *NodeAllocation, usage nodeUsage) {
+    alloc.CPUUsage = float64(usage.CPUUsage) / 1000.0
+    alloc.CPUUsageRequestPct = 100 * ratio(float64(usage.PodCPUUsage)/1000.0, alloc.CPUAllocated)
+    alloc.CPUUsageAllocatablePct = 100 * ratio(alloc.CPUUsage, alloc.CPUAllocatable)
+    alloc.RAMUsage = float64(usage.RAMUsage) / (1024 * 1024 * 1024)
+    alloc.RAMUsageRequestPct = 100 * ratio(float64(usage.PodRAMUsage)/(1024*1024*1024), alloc.RAMAllocated)
+    alloc.RAMUsageAllocatablePct = 100 * ratio(alloc.RAMUsage, alloc.RAMAllocatable)
+}
+
+// containerUsage is the observed usage of a single container.
+type containerUsage struct {
+    CPUUsage int64 // millicores
+    RAMUsage int64 // bytes
+}
+
+// fetchPodUsage queries the metrics.k8s.io API for pod metrics and returns
+// the usage of every container, keyed by namespace/name of the pod and then
+// by container name.
+func fetchPodUsage(metricsClient metricsclientset.Interface) (map[string]map[string]containerUsage, error) {
+    podMetrics, err := metricsClient.MetricsV1beta1().PodMetricses("").List(context.TODO(), metav1.ListOptions{})
+    if err != nil {
+        return nil, err
+    }
+    usage := make(map[string]map[string]containerUsage, len(podMetrics.Items))
+    for _, metrics := range podMetrics.Items {
+        containers := make(map[string]containerUsage, len(metrics.Containers))
+        for _, container := range metrics.Containers {
+            containers[container.Name] = containerUsage{
+                CPUUsage: container.Usage.Cpu().MilliValue(),
+                RAMUsage: container.Usage.Memory().Value(),
+            }
+        }
+        usage[metrics.Namespace+"/"+metrics.Name] = containers
+    }
+    return usage, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+
+    corev1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/runtime/schema"
+    k8stesting "k8s.io/client-go/testing"
+    metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+    metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+    metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+// metricsSource is a clusterSource that only serves usage, read from a
+// metrics client.
+type metricsSource struct {
+    clusterSource
+    client metricsclientset.Interface
+}
+
+func (s metricsSource) Usage(pods []corev1.Pod) (map[string]nodeUsage, error) {
+    return fetchUsage(s.client, pods)
+}
+
+// newMetricsClient returns a fake metrics client serving the given node and
+// pod metrics. They are added to the tracker by hand, as it can't guess the
+// nodes and pods resources of the metrics API from their kinds.
+func newMetricsClient(t *testing.T, objects ...runtime.Object) *metricsfake.Clientset {
+    t.Helper()
+    client := metricsfake.NewSimpleClientset()
+    for _, object := range objects {
+        var err error
+        switch metrics := object.(type) {
+        case *metricsv1beta1.NodeMetrics:
+            err = client.Tracker().Create(metricsv1beta1.SchemeGroupVersion.WithResource("nodes"), metrics, "")
+        case *metricsv1beta1.PodMetrics:
+            err = client.Tracker().Create(metricsv1beta1.SchemeGroupVersion.WithResource("pods"), metrics, metrics.Namespace)
+        }
+        if err != nil {
+            t.Fatalf("adding metrics: %s", err)
+        }
+    }
+    return client
+}
+
+func testNodeMetrics(name, cpu, memory string) *metricsv1beta1.NodeMetrics {
+    return &metricsv1beta1.NodeMetrics{
+        ObjectMeta: metav1.ObjectMeta{Name: name},
+        Usage:      resourceList(cpu, memory),
+    }
+}
+
+func testPodMetrics(namespace, name string, containers ...metricsv1beta1.ContainerMetrics) *metricsv1beta1.PodMetrics {
+    return &metricsv1beta1.PodMetrics{
+        ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+        Containers: containers,
+    }
+}
+
+func testContainerMetrics(name, cpu, memory string) metricsv1beta1.ContainerMetrics {
+    return metricsv1beta1.ContainerMetrics{Name: name, Usage: resourceList(cpu, memory)}
+}
+
+func TestFetchUsage(t *testing.T) {
+    client := newMetricsClient(t,
+        testNodeMetrics("node-a", "1500m", "3Gi"),
+        testPodMetrics("default", "web",
+            testContainerMetrics("app", "300m", "768Mi"),
+            testContainerMetrics("proxy", "200m", "256Mi"),
+        ),
+        // Pods that are not in the pod list, e.g. pending or deleted
+        // since, are not attributed to any node
+        testPodMetrics("default", "gone", testContainerMetrics("app", "5", "5Gi")),
+    )
+    nodes := []corev1.Node{
+        testNode("node-a", "4", "8Gi", 110),
+        testNode("node-b", "4", "8Gi", 110),
+    }
+    pods := []corev1.Pod{
+        testPod("default", "web", "node-a", "1", "2Gi"),
+        // idle has no metrics yet, so it only adds to the requests
+        testPod("default", "idle", "node-a", "1", "2Gi"),
+        testPod("default", "batch", "node-b", "1", "1Gi"),
+    }
+
+    usage, err := fetchUsage(client, pods)
+    if err != nil {
+        t.Fatalf("fetchUsage: %s", err)
+    }
+    want := nodeUsage{CPUUsage: 1500, RAMUsage: 3 << 30, PodCPUUsage: 500, PodRAMUsage: 1 << 30}
+    if usage["node-a"] != want {
+        t.Errorf("node-a usage: got %+v, want %+v", usage["node-a"], want)
+    }
+    if usage["node-b"] != (nodeUsage{}) {
+        t.Errorf("node-b has no metrics, got usage %+v", usage["node-b"])
+    }
+
+    allocations := buildAllocations(nodes, podsByNode(pods), usage, reportOptions{Basis: basisAllocatable})
+    alloc, err := findAllocation(allocations, "node-a")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, check := range []struct {
+        name      string
+        got, want float64
+    }{
+        {"CPUUsage", alloc.CPUUsage, 1.5},
+        {"CPUUsageRequestPct", alloc.CPUUsageRequestPct, 25},
+        {"CPUUsageAllocatablePct", alloc.CPUUsageAllocatablePct, 37.5},
+        {"RAMUsage", alloc.RAMUsage, 3},
+        {"RAMUsageRequestPct", alloc.RAMUsageRequestPct, 25},
+        {"RAMUsageAllocatablePct", alloc.RAMUsageAllocatablePct, 37.5},
+    } {
+        if check.got != check.want {
+            t.Errorf("node-a %s: got %v, want %v", check.name, check.got, check.want)
+        }
+    }
+
+    alloc, err = findAllocation(allocations, "node-b")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if alloc.CPUUsage != 0 || alloc.CPUUsageRequestPct != 0 || alloc.RAMUsage != 0 || alloc.RAMUsageRequestPct != 0 {
+        t.Errorf("node-b has no metrics, got usage %+v", alloc)
+    }
+}
+
+func TestUsageOrWarnWithoutMetricsAPI(t *testing.T) {
+    client := metricsfake.NewSimpleClientset()
+    client.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        resource := schema.GroupResource{Group: "metrics.k8s.io", Resource: action.GetResource().Resource}
+        return true, nil, apierrors.NewNotFound(resource, "")
+    })
+
+    var warnings bytes.Buffer
+    usage := usageOrWarn(metricsSource{client: client}, nil, &warnings)
+    if usage != nil {
+        t.Errorf("got usage %v without a metrics API", usage)
+    }
+    if !strings.HasPrefix(warnings.String(), "Warning: usage data unavailable, is metrics-server installed?") {
+        t.Errorf("got warning %q", warnings.String())
+    }
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "io"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/informers"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/tools/cache"
+)
+
+const (
+    // ansiClear moves the cursor home and clears the screen.
+    ansiClear = "\x1b[H\x1b[2J"
+    // ansiHighlight and ansiPlain are the same length, so that highlighted
+    // and plain cells take up the same width in the tabwriter.
+    ansiHighlight = "\x1b[7m"
+    ansiPlain     = "\x1b[0m"
+    ansiReset     = "\x1b[0m"
+)
+
+// watchSource keeps Node and Pod informers running and serves the current
+// nodes and pods from their caches.
+type watchSource struct {
+    nodeStore cache.Indexer
+    podStore  cache.Indexer
+    changed    chan struct{}
+}
+
+// newWatchSource starts the informers and waits for their caches to sync.
+// changed receives a value whenever a node or pod is added, updated or
+// deleted; notifications that arrive while one is pending are coalesced.
+func newWatchSource(ctx context.Context, clientset kubernetes.Interface, selector string) (*watchSource, error) {
+    nodeFactory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+        o.LabelSelector = selector
+    }))
+    podFactory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+        o.FieldSelector = "spec.nodeName!="
+    }))
+    nodeInformer := nodeFactory.Core().V1().Nodes().Informer()
+    podInformer := podFactory.Core().V1().Pods().Informer()
+
+    source := &watchSource{
+        nodeStore: nodeInformer.GetIndexer(),
+        podStore:  podInformer.GetIndexer(),
+        changed:    make(chan struct{}, 1),
+    }
+    notify := func() {
+        select {
+        case source.changed <- struct{}{}:
+        default:
+        }
+    }
+    handler := cache.ResourceEventHandlerFuncs{
+        AddFunc:    func(interface{}) { notify() },
+        UpdateFunc: func(interface{}, interface{}) { notify() },
+        DeleteFunc: func(interface{}) { notify() },
+    }
+    if _, err := nodeInformer.AddEventHandler(handler); err != nil {
+        return nil, err
+    }
+    if _, err := podInformer.AddEventHandler(handler); err != nil {
+        return nil, err
+    }
+
+    nodeFactory.Start(ctx.Done())
+    podFactory.Start(ctx.Done())
+    if !cache.WaitForCacheSync(ctx.Done(), nodeInformer.HasSynced, podInformer.HasSynced) {
+        return nil, fmt.Errorf("timed out waiting for node and pod caches to sync")
+    }
+    return source, nil
+}
+
+// snapshot returns the nodes and pods currently in the informer caches.
+func (s *watchSource) snapshot() ([]corev1.Node, []corev1.Pod) {
+    var nodes []corev1.Node
+    for _, obj := range s.nodeStore.List() {
+        nodes = append(nodes, *obj.(*corev1.Node))
+    }
+    var pods []corev1.Pod
+    for _, obj := range s.podStore.List() {
+        pods = append(pods, *obj.(*corev1.Pod))
+    }
+    return nodes, pods
+}
+
+// runWatch redraws the node table in place whenever allocations change,
+// highlighting the cells that changed since the previous draw. Redraws are
+// at least interval apart; changes arriving in between are folded into the
+// next redraw. It returns when ctx is cancelled.
+func runWatch(ctx context.Context, out io.Writer, clientset kubernetes.Interface, selector string, opts reportOptions, columns []tableColumn, noHeaders bool, interval time.Duration) error {
+    source, err := newWatchSource(ctx, clientset, selector)
+    if err != nil {
+        return err
+    }
+
+    var previous map[string]map[string]string
+    for {
+        select {
+        case <-ctx.Done():
+            return nil
+        case <-source.changed:
+        }
+
+        nodes, pods := source.snapshot()
+        allocations := finishAllocations(buildAllocations(nodes, podsByNode(pods), nil, opts), opts)
+        current := tableCells(allocations, columns)
+
+        var buf bytes.Buffer
+        buf.WriteString(ansiClear)
+        fmt.Fprintf(&buf, "Last updated: %s (refreshing at most every %s, press Ctrl+C to exit)\n\n", time.Now().Format(time.RFC1123), interval)
+        writeTable(&buf, allocations, noHeaders, columns, func(nodeName, columnKey, value string) string {
+            if nodeName != "" && previous != nil && previous[nodeName][columnKey] != current[nodeName][columnKey] {
+                return ansiHighlight + value + ansiReset
+            }
+            return ansiPlain + value + ansiReset
+        })
+        if _, err := out.Write(buf.Bytes()); err != nil {
+            return err
+        }
+        previous = current
+
+        select {
+        case <-ctx.Done():
+            return nil
+        case <-time.After(interval):
+        }
+    }
+}
+
+// tableCells returns the table values of each node keyed by node name and
+// column key, for comparing one draw with the next.
+func tableCells(allocations []NodeAllocation, columns []tableColumn) map[string]map[string]string {
+    cells := make(map[string]map[string]string, len(allocations))
+    for _, alloc := range allocations {
+        row := map[string]string{"": alloc.NodeName}
+        for _, column := range columns {
+            row[column.Key] = column.Value(alloc)
+        }
+        cells[alloc.NodeName] = row
+    }
+    return cells
+}
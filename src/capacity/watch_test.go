@@ -0,0 +1,207 @@
+package main
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+
+    corev1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/watch"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+)
+
+// newWatchedClientset returns a fake clientset holding the given objects,
+// and a channel that receives a value each time an informer starts
+// watching. The fake clientset drops events sent before the watch starts,
+// so tests must wait for both the node and the pod watch before changing
+// anything.
+func newWatchedClientset(objects ...runtime.Object) (*fake.Clientset, chan string) {
+    clientset := fake.NewClientset(objects...)
+    watching := make(chan string, 2)
+    clientset.PrependWatchReactor("*", func(action k8stesting.Action) (bool, watch.Interface, error) {
+        w, err := clientset.Tracker().Watch(action.GetResource(), action.GetNamespace())
+        select {
+        case watching <- action.GetResource().Resource:
+        default:
+        }
+        return true, w, err
+    })
+    return clientset, watching
+}
+
+// waitForWatches waits until both informers watch the fake clientset.
+func waitForWatches(t *testing.T, watching chan string) {
+    t.Helper()
+    for i := 0; i < 2; i++ {
+        select {
+        case <-watching:
+        case <-time.After(5 * time.Second):
+            t.Fatal("timed out waiting for the informers to watch")
+        }
+    }
+}
+
+func createPods(t *testing.T, clientset *fake.Clientset, pods ...corev1.Pod) {
+    t.Helper()
+    for i := range pods {
+        if _, err := clientset.CoreV1().Pods(pods[i].Namespace).Create(context.TODO(), &pods[i], metav1.CreateOptions{}); err != nil {
+            t.Fatalf("creating pod %s: %s", pods[i].Name, err)
+        }
+    }
+}
+
+func TestWatchSourceCoalescesChanges(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    node := testNode("node-a", "4", "8Gi", 110)
+    pod := testPod("default", "web", "node-a", "1", "1Gi")
+    clientset, watching := newWatchedClientset(&node, &pod)
+
+    source, err := newWatchSource(ctx, clientset, "")
+    if err != nil {
+        t.Fatalf("newWatchSource: %s", err)
+    }
+    waitForWatches(t, watching)
+
+    // The initial node and pod fire a single pending change
+    select {
+    case <-source.changed:
+    case <-time.After(5 * time.Second):
+        t.Fatal("no change for the initial node and pod")
+    }
+    time.Sleep(100 * time.Millisecond)
+    select {
+    case <-source.changed:
+    default:
+    }
+
+    createPods(t, clientset,
+        testPod("default", "a", "node-a", "100m", "128Mi"),
+        testPod("default", "b", "node-a", "100m", "128Mi"),
+        testPod("default", "c", "node-a", "100m", "128Mi"),
+    )
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        if _, pods := source.snapshot(); len(pods) == 4 {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("timed out waiting for the new pods to reach the cache")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    time.Sleep(100 * time.Millisecond)
+
+    select {
+    case <-source.changed:
+    default:
+        t.Fatal("no change after adding pods")
+    }
+    select {
+    case <-source.changed:
+        t.Error("three pod additions fired more than one pending change")
+    default:
+    }
+
+    nodes, pods := source.snapshot()
+    if len(nodes) != 1 || nodes[0].Name != "node-a" || len(pods) != 4 {
+        t.Errorf("got %d nodes and %d pods, want node-a and 4 pods", len(nodes), len(pods))
+    }
+}
+
+// frame is one redraw of the watch table.
+type frame struct {
+    at   time.Time
+    text string
+}
+
+// frameWriter sends every write, which runWatch does once per redraw, to
+// frames.
+type frameWriter struct {
+    frames chan frame
+}
+
+func (w frameWriter) Write(p []byte) (int, error) {
+    w.frames <- frame{at: time.Now(), text: string(p)}
+    return len(p), nil
+}
+
+func TestRunWatch(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    node := testNode("node-a", "4", "8Gi", 110)
+    pod := testPod("default", "web", "node-a", "1", "1Gi")
+    clientset, watching := newWatchedClientset(&node, &pod)
+
+    var columns []tableColumn
+    for _, key := range []string{"pod-capacity", "deployed-pods"} {
+        column, _ := findColumn(key, nil)
+        columns = append(columns, column)
+    }
+    out := frameWriter{frames: make(chan frame, 10)}
+    const interval = 300 * time.Millisecond
+    done := make(chan error, 1)
+    go func() {
+        done <- runWatch(ctx, out, clientset, "", reportOptions{Basis: basisAllocatable}, columns, true, interval)
+    }()
+
+    nextFrame := func() frame {
+        t.Helper()
+        select {
+        case f := <-out.frames:
+            return f
+        case <-time.After(5 * time.Second):
+            t.Fatal("timed out waiting for a redraw")
+        }
+        return frame{}
+    }
+
+    first := nextFrame()
+    if !strings.HasPrefix(first.text, ansiClear) {
+        t.Errorf("redraw does not clear the screen: %q", first.text)
+    }
+    if strings.Contains(first.text, ansiHighlight) {
+        t.Errorf("first draw has highlighted cells: %q", first.text)
+    }
+    if !strings.Contains(first.text, ansiPlain+"1"+ansiReset) {
+        t.Errorf("first draw does not show one deployed pod: %q", first.text)
+    }
+
+    waitForWatches(t, watching)
+    createPods(t, clientset,
+        testPod("default", "a", "node-a", "100m", "128Mi"),
+        testPod("default", "b", "node-a", "100m", "128Mi"),
+    )
+
+    second := nextFrame()
+    if elapsed := second.at.Sub(first.at); elapsed < interval {
+        t.Errorf("redrew after %s, want at least %s", elapsed, interval)
+    }
+    if !strings.Contains(second.text, ansiHighlight+"3"+ansiReset) {
+        t.Errorf("changed deployed pod count is not highlighted: %q", second.text)
+    }
+    if !strings.Contains(second.text, ansiPlain+"110"+ansiReset) {
+        t.Errorf("unchanged pod capacity is highlighted: %q", second.text)
+    }
+
+    // Both additions were folded into the second redraw
+    select {
+    case f := <-out.frames:
+        t.Errorf("unexpected redraw without changes: %q", f.text)
+    case <-time.After(2 * interval):
+    }
+
+    cancel()
+    select {
+    case err := <-done:
+        if err != nil {
+            t.Errorf("runWatch: %s", err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("runWatch did not return after cancel")
+    }
+}